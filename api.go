@@ -1,6 +1,7 @@
 package zmey
 
 import (
+	"fmt"
 	"log"
 )
 
@@ -13,26 +14,63 @@ type API interface {
 	Return(payload interface{})
 	// Trace used for logging
 	Trace(payload interface{})
-	// ReportError should be used for any errors to be escalated to the upper layer
-	// There is no specific error handling implemented, currently the errors are
-	// just printed via log package
+	// ReportError should be used for any errors to be escalated to the upper
+	// layer. The errors are collected per process, and Round returns them in
+	// a FailedError.
 	ReportError(error)
+	// Now returns the time observed by the process: the virtual time,
+	// adjusted by the skew of the process clock (see Zmey.Skew). Virtual time
+	// and timers require Config.Deterministic, otherwise Now always returns 0.
+	Now() uint
+	// SetTimer arms a timer firing after `after` units of time, as observed by
+	// the process. The process receives it via TimerProcess.ReceiveTimer.
+	// SetTimer returns the id of the timer. Timers require
+	// Config.Deterministic: in a concurrent Round, no timer is armed, SetTimer
+	// returns -1 and the process fails with ErrNotDeterministic.
+	SetTimer(after uint, payload interface{}) int
+	// CancelTimer disarms the timer with the id `id`, if it has not fired yet.
+	// Like SetTimer, it fails with ErrNotDeterministic in a concurrent Round.
+	CancelTimer(id int)
+	// Pids returns the ids of all the processes, in increasing order
+	Pids() []int
+	// Group returns the ids of the processes of the group `name`, in
+	// increasing order (see Zmey.SetGroup)
+	Group(name string) []int
+	// Broadcast sends the message to all the other processes
+	Broadcast(payload interface{})
+	// Multicast sends the message to all the processes of the group `name`,
+	// including the sender if it belongs to the group
+	Multicast(name string, payload interface{})
 }
 
 // api implements exported API interface
 type api struct {
 	// scale   int
-	pid     int
-	net     *Net
-	returnC chan interface{}
-	traceC  chan interface{}
-	debug   bool
+	pid      int
+	net      *Net
+	collectC chan collectItem
+	sched    *scheduler
+	session  *Session
+	z        *Zmey
+	debug    bool
 }
 
 func (a *api) BindNet(net *Net) {
 	a.net = net
 }
 
+// BindSession makes the api report the returns and traces in flight to the
+// session
+func (a *api) BindSession(session *Session) {
+	a.session = session
+}
+
+// BindScheduler makes the api report to the scheduler instead of the
+// channels. Passing nil switches back to the channels.
+func (a *api) BindScheduler(sched *scheduler) {
+	a.sched = sched
+}
+
 func (a *api) Send(to int, payload interface{}) {
 	if a.debug {
 		log.Printf("[%4d] Send: sending message %+v", a.pid, payload)
@@ -41,6 +79,8 @@ func (a *api) Send(to int, payload interface{}) {
 		err := a.net.Send(a.pid, to, payload)
 		if err != nil {
 			log.Printf("[%4d] Send: Error: %s", a.pid, err)
+		} else if a.z != nil {
+			a.z.count(a.pid, 1, 0)
 		}
 	} else {
 		log.Printf("[%4d] Send: Error: network is nil", a.pid)
@@ -50,11 +90,60 @@ func (a *api) Send(to int, payload interface{}) {
 	}
 }
 
+func (a *api) Pids() []int {
+	return append([]int{}, a.z.pids...)
+}
+
+func (a *api) Group(name string) []int {
+	return append([]int{}, a.z.groups[name]...)
+}
+
+func (a *api) Broadcast(payload interface{}) {
+	tos := make([]int, 0, len(a.z.pids))
+	for _, pid := range a.z.pids {
+		if pid != a.pid {
+			tos = append(tos, pid)
+		}
+	}
+	a.multicast(tos, payload)
+}
+
+func (a *api) Multicast(name string, payload interface{}) {
+	a.multicast(a.z.groups[name], payload)
+}
+
+func (a *api) multicast(tos []int, payload interface{}) {
+	if a.debug {
+		log.Printf("[%4d] Multicast: sending message %+v to %v", a.pid, payload, tos)
+	}
+	if a.net != nil {
+		err := a.net.Multicast(a.pid, tos, payload)
+		if err != nil {
+			log.Printf("[%4d] Multicast: Error: %s", a.pid, err)
+		} else {
+			a.z.countMulticast(a.pid, len(tos))
+		}
+	} else {
+		log.Printf("[%4d] Multicast: Error: network is nil", a.pid)
+	}
+	if a.debug {
+		log.Printf("[%4d] Multicast: done", a.pid)
+	}
+}
+
 func (a *api) Return(c interface{}) {
 	if a.debug {
 		log.Printf("[%4d] Return: returning call %+v", a.pid, c)
 	}
-	a.returnC <- c
+	if a.sched != nil {
+		a.sched.collectReturn(a.pid, c)
+	} else {
+		// The event is reported right away, the entry is collected later
+		clock := a.z.stamp(a.pid)
+		a.z.emit(Event{Kind: EventReturn, Pid: a.pid, Payload: c, Clock: clock})
+		a.session.begin(flightReturn)
+		a.collectC <- collectItem{pid: a.pid, kind: entryResponse, payload: c, clock: clock}
+	}
 	if a.debug {
 		log.Printf("[%4d] Return: done", a.pid)
 	}
@@ -64,9 +153,51 @@ func (a *api) Trace(t interface{}) {
 	if a.debug {
 		log.Printf("[%4d] T: %+v", a.pid, t)
 	}
-	a.traceC <- t
+	if a.sched != nil {
+		a.sched.collectTrace(a.pid, t)
+	} else {
+		clock := a.z.stamp(a.pid)
+		a.z.emit(Event{Kind: EventTrace, Pid: a.pid, Payload: t, Clock: clock})
+		a.session.begin(flightTrace)
+		a.collectC <- collectItem{pid: a.pid, kind: entryTrace, payload: t, clock: clock}
+	}
 }
 
 func (a *api) ReportError(err error) {
 	log.Printf("[%4d] ReportError: %s", a.pid, err)
+	if a.z != nil {
+		clock := a.z.stamp(a.pid)
+		a.z.emit(Event{Kind: EventError, Pid: a.pid, Payload: err, Clock: clock})
+		a.z.collect(a.pid, entryError, err, clock)
+	}
+}
+
+func (a *api) Now() uint {
+	if a.sched == nil {
+		return 0
+	}
+	return a.sched.z.clocks[a.pid].local(a.sched.z.now)
+}
+
+func (a *api) SetTimer(after uint, payload interface{}) int {
+	if a.sched == nil {
+		a.ReportError(fmt.Errorf("SetTimer: %w", ErrNotDeterministic))
+		return -1
+	}
+	id := a.sched.setTimer(a.pid, after, payload)
+	if a.debug {
+		log.Printf("[%4d] SetTimer: timer %d armed for %d", a.pid, id, after)
+	}
+	return id
+}
+
+func (a *api) CancelTimer(id int) {
+	if a.sched == nil {
+		a.ReportError(fmt.Errorf("CancelTimer: %w", ErrNotDeterministic))
+		return
+	}
+	a.sched.cancelTimer(a.pid, id)
+	if a.debug {
+		log.Printf("[%4d] CancelTimer: timer %d cancelled", a.pid, id)
+	}
 }
@@ -0,0 +1,139 @@
+package zmey
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// chromeEvent is an event of the Chrome Trace Event format
+type chromeEvent struct {
+	Name  string                 `json:"name"`
+	Cat   string                 `json:"cat,omitempty"`
+	Ph    string                 `json:"ph"`
+	Ts    float64                `json:"ts"`
+	Dur   *float64               `json:"dur,omitempty"`
+	Pid   int                    `json:"pid"`
+	Tid   int                    `json:"tid"`
+	ID    int                    `json:"id,omitempty"`
+	Bp    string                 `json:"bp,omitempty"`
+	Scope string                 `json:"s,omitempty"`
+	Args  map[string]interface{} `json:"args,omitempty"`
+}
+
+// chromeTrace is the JSON object of the Chrome Trace Event format
+type chromeTrace struct {
+	TraceEvents     []chromeEvent `json:"traceEvents"`
+	DisplayTimeUnit string        `json:"displayTimeUnit"`
+}
+
+// WriteChromeTrace writes the events in the Chrome Trace Event format, which
+// can be opened in Perfetto or chrome://tracing. Each process gets a track,
+// where the handlers of the deliveries, calls, ticks, timers and membership
+// events are drawn as slices over the wall-clock time, and the returns,
+// traces, faults, errors and panics as instant events. Flow arrows link the sending
+// of each message to its delivery. The events should include EventDone, as
+// the ones recorded by Zmey do.
+func WriteChromeTrace(w io.Writer, events []Event) error {
+	trace := chromeTrace{
+		TraceEvents:     []chromeEvent{},
+		DisplayTimeUnit: "ns",
+	}
+
+	// Flow arrows are only drawn for the messages delivered
+	delivered := make(map[int]bool)
+	for _, e := range events {
+		if e.Kind == EventDeliver {
+			delivered[e.Msg] = true
+		}
+	}
+
+	seen := make(map[int]bool)
+	// open holds the index of the slice of the running handler per process
+	open := make(map[int]int)
+	var last float64
+
+	for _, e := range events {
+		ts := float64(e.Wall.Nanoseconds()) / 1000
+		last = ts
+		seen[e.Pid] = true
+		args := map[string]interface{}{
+			"seq":     e.Seq,
+			"time":    e.Time,
+			"payload": fmt.Sprintf("%+v", e.Payload),
+		}
+
+		switch e.Kind {
+		case EventDeliver, EventCall, EventTick, EventTimer, EventMembership:
+			name := e.Kind.String()
+			if e.Kind == EventDeliver {
+				name = fmt.Sprintf("deliver from %d", e.Peer)
+				args["msg"] = e.Msg
+			}
+			open[e.Pid] = len(trace.TraceEvents)
+			trace.TraceEvents = append(trace.TraceEvents, chromeEvent{
+				Name: name, Cat: "handler", Ph: "X", Ts: ts, Pid: 0, Tid: e.Pid, Args: args,
+			})
+			if e.Kind == EventDeliver {
+				trace.TraceEvents = append(trace.TraceEvents, chromeEvent{
+					Name: "message", Cat: "message", Ph: "f", Bp: "e", Ts: ts, Pid: 0, Tid: e.Pid, ID: e.Msg,
+				})
+			}
+		case EventDone:
+			if i, ok := open[e.Pid]; ok {
+				dur := ts - trace.TraceEvents[i].Ts
+				trace.TraceEvents[i].Dur = &dur
+				delete(open, e.Pid)
+			}
+		case EventSend:
+			args["to"] = e.Peer
+			args["msg"] = e.Msg
+			trace.TraceEvents = append(trace.TraceEvents, chromeEvent{
+				Name: fmt.Sprintf("send to %d", e.Peer), Cat: "message", Ph: "i", Scope: "t", Ts: ts, Pid: 0, Tid: e.Pid, Args: args,
+			})
+			if delivered[e.Msg] {
+				trace.TraceEvents = append(trace.TraceEvents, chromeEvent{
+					Name: "message", Cat: "message", Ph: "s", Ts: ts, Pid: 0, Tid: e.Pid, ID: e.Msg,
+				})
+			}
+		case EventFilterDrop:
+			args["to"] = e.Peer
+			args["msg"] = e.Msg
+			trace.TraceEvents = append(trace.TraceEvents, chromeEvent{
+				Name: fmt.Sprintf("filtered to %d", e.Peer), Cat: "message", Ph: "i", Scope: "t", Ts: ts, Pid: 0, Tid: e.Pid, Args: args,
+			})
+		case EventReturn, EventTrace, EventFault, EventError, EventPanic:
+			trace.TraceEvents = append(trace.TraceEvents, chromeEvent{
+				Name: e.Kind.String(), Cat: "process", Ph: "i", Scope: "t", Ts: ts, Pid: 0, Tid: e.Pid, Args: args,
+			})
+		}
+	}
+
+	// The handlers still running when the Round ended are closed at the
+	// last event
+	for _, i := range open {
+		dur := last - trace.TraceEvents[i].Ts
+		trace.TraceEvents[i].Dur = &dur
+	}
+
+	pids := make([]int, 0, len(seen))
+	for pid := range seen {
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+
+	metadata := []chromeEvent{{
+		Name: "process_name", Ph: "M", Pid: 0, Args: map[string]interface{}{"name": "zmey"},
+	}}
+	for _, pid := range pids {
+		metadata = append(metadata, chromeEvent{
+			Name: "thread_name", Ph: "M", Pid: 0, Tid: pid, Args: map[string]interface{}{"name": fmt.Sprintf("process %d", pid)},
+		}, chromeEvent{
+			Name: "thread_sort_index", Ph: "M", Pid: 0, Tid: pid, Args: map[string]interface{}{"sort_index": pid},
+		})
+	}
+	trace.TraceEvents = append(metadata, trace.TraceEvents...)
+
+	return json.NewEncoder(w).Encode(trace)
+}
@@ -0,0 +1,93 @@
+package zmey
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteChromeTrace(t *testing.T) {
+	us := time.Microsecond
+	events := []Event{
+		{Seq: 1, Wall: 1 * us, Kind: EventCall, Pid: 0, Payload: 1},
+		{Seq: 2, Wall: 2 * us, Kind: EventSend, Pid: 0, Peer: 1, Msg: 1, Payload: "ping"},
+		{Seq: 3, Wall: 2 * us, Kind: EventBuffer, Pid: 1, Peer: 0, Msg: 1, Payload: "ping"},
+		{Seq: 4, Wall: 2 * us, Kind: EventSend, Pid: 0, Peer: 2, Msg: 2, Payload: "ping"},
+		{Seq: 5, Wall: 2 * us, Kind: EventFilterDrop, Pid: 0, Peer: 2, Msg: 2, Payload: "ping"},
+		{Seq: 6, Wall: 3 * us, Kind: EventDone, Pid: 0, Payload: EventCall},
+		{Seq: 7, Wall: 5 * us, Kind: EventDeliver, Pid: 1, Peer: 0, Msg: 1, Payload: "ping"},
+		{Seq: 8, Wall: 6 * us, Kind: EventReturn, Pid: 1, Payload: 42},
+	}
+
+	var b bytes.Buffer
+	require.NoError(t, WriteChromeTrace(&b, events))
+
+	var trace chromeTrace
+	require.NoError(t, json.Unmarshal(b.Bytes(), &trace))
+
+	type slice struct {
+		Name string
+		Ph   string
+		Ts   float64
+		Dur  float64
+		Tid  int
+		ID   int
+	}
+	slices := []slice{}
+	for _, e := range trace.TraceEvents {
+		s := slice{Name: e.Name, Ph: e.Ph, Ts: e.Ts, Tid: e.Tid, ID: e.ID}
+		if e.Dur != nil {
+			s.Dur = *e.Dur
+		}
+		slices = append(slices, s)
+	}
+
+	assert.Equal(t, []slice{
+		{Name: "process_name", Ph: "M"},
+		{Name: "thread_name", Ph: "M", Tid: 0},
+		{Name: "thread_sort_index", Ph: "M", Tid: 0},
+		{Name: "thread_name", Ph: "M", Tid: 1},
+		{Name: "thread_sort_index", Ph: "M", Tid: 1},
+		{Name: "call", Ph: "X", Ts: 1, Dur: 2, Tid: 0},
+		{Name: "send to 1", Ph: "i", Ts: 2, Tid: 0},
+		{Name: "message", Ph: "s", Ts: 2, Tid: 0, ID: 1},
+		{Name: "send to 2", Ph: "i", Ts: 2, Tid: 0},
+		{Name: "filtered to 2", Ph: "i", Ts: 2, Tid: 0},
+		// The handler is still running at the end, it's closed at the last
+		// event
+		{Name: "deliver from 0", Ph: "X", Ts: 5, Dur: 1, Tid: 1},
+		{Name: "message", Ph: "f", Ts: 5, Tid: 1, ID: 1},
+		{Name: "return", Ph: "i", Ts: 6, Tid: 1},
+	}, slices)
+	assert.Equal(t, "ns", trace.DisplayTimeUnit)
+}
+
+func TestWriteChromeTraceRound(t *testing.T) {
+	z := newTestZmey(&Config{Events: true}, 4, newFanoutProcess, "broadcast")
+
+	result, err := z.Run(context.Background())
+	require.NoError(t, err)
+
+	var b bytes.Buffer
+	require.NoError(t, WriteChromeTrace(&b, result.Events))
+
+	var trace chromeTrace
+	require.NoError(t, json.Unmarshal(b.Bytes(), &trace))
+
+	phases := map[string]int{}
+	for _, e := range trace.TraceEvents {
+		phases[e.Ph]++
+		if e.Ph == "X" {
+			assert.NotNil(t, e.Dur)
+		}
+	}
+	// A call and three deliveries, each message with its flow arrow
+	assert.Equal(t, 4, phases["X"])
+	assert.Equal(t, 3, phases["s"])
+	assert.Equal(t, 3, phases["f"])
+}
@@ -12,7 +12,8 @@ type Client interface {
 
 type client struct {
 	pid   int
-	callC chan interface{}
+	sched *scheduler
+	drv   *driver
 	debug bool
 }
 
@@ -20,7 +21,11 @@ func (c client) Call(payload interface{}) {
 	if c.debug {
 		log.Printf("[%4d] Call: received %+v", c.pid, payload)
 	}
-	c.callC <- payload
+	if c.sched != nil {
+		c.sched.call(c.pid, payload)
+	} else {
+		c.drv.call(c.pid, payload)
+	}
 	if c.debug {
 		log.Printf("[%4d] Call: done", c.pid)
 	}
@@ -0,0 +1,148 @@
+package zmey
+
+import (
+	"log"
+	"math"
+	"sort"
+)
+
+// Skew describes how the clock of a process diverges from the virtual time
+type Skew struct {
+	// Offset is added to the time observed by the process
+	Offset int
+	// Drift is the relative error of the clock rate, e.g. with 0.01 the clock
+	// of the process runs 1% faster than the virtual time. Drift should be
+	// greater than -1.
+	Drift float64
+}
+
+// clock converts the virtual time into the time observed by a process. The
+// observed time is `base + (now - anchor) * (1 + Drift) + Offset`, where
+// `anchor` is the virtual time of the last change of the skew.
+type clock struct {
+	anchor uint
+	base   float64
+	skew   Skew
+}
+
+// local returns the time observed by the process at the virtual time `now`
+func (c *clock) local(now uint) uint {
+	if c == nil {
+		return now
+	}
+
+	t := c.base + float64(now-c.anchor)*(1+c.skew.Drift) + float64(c.skew.Offset)
+	if t < 0 {
+		return 0
+	}
+	return uint(math.Floor(t + 1e-9))
+}
+
+// deadline returns the earliest virtual time at which the process observes
+// the time `local`, or `now` if it's already the case
+func (c *clock) deadline(now uint, local uint) uint {
+	if c == nil {
+		if local < now {
+			return now
+		}
+		return local
+	}
+
+	if local <= c.local(now) {
+		return now
+	}
+
+	d := math.Ceil((float64(local)-float64(c.skew.Offset)-c.base)/(1+c.skew.Drift) - 1e-9)
+	if d < 0 || c.anchor+uint(d) < now {
+		return now
+	}
+	return c.anchor + uint(d)
+}
+
+// duration converts the duration `d` observed by the process into the
+// virtual time
+func (c *clock) duration(d uint) uint {
+	if c == nil {
+		return d
+	}
+	return uint(math.Round(float64(d) * (1 + c.skew.Drift)))
+}
+
+// set changes the skew at the virtual time `now`. The drift only affects the
+// time elapsed from now on, while the offset applies immediately.
+func (c *clock) set(now uint, skew Skew) {
+	c.base += float64(now-c.anchor) * (1 + c.skew.Drift)
+	c.anchor = now
+	c.skew = skew
+}
+
+// action is applied by the deterministic scheduler once the virtual time
+// reaches `at`
+type action struct {
+	at    uint
+	apply func()
+}
+
+// schedule inserts the action in the timeline, after the actions scheduled
+// at the same time
+func (z *Zmey) schedule(at uint, apply func()) {
+	i := sort.Search(len(z.timeline), func(i int) bool {
+		return z.timeline[i].at > at
+	})
+	z.timeline = append(z.timeline, action{})
+	copy(z.timeline[i+1:], z.timeline[i:])
+	z.timeline[i] = action{at: at, apply: apply}
+}
+
+// Skew changes the clock of the process `pid`. The change takes effect at
+// the current virtual time. Skew is thread-safe.
+func (z *Zmey) Skew(pid int, skew Skew) {
+	z.Lock()
+	defer z.Unlock()
+
+	z.setSkew(pid, skew)
+}
+
+// SkewAt changes the clock of the process `pid` once the virtual time
+// reaches `t`, in the middle of a deterministic Round if need be. SkewAt
+// requires Config.Deterministic, otherwise it logs an error and schedules
+// nothing. SkewAt is thread-safe.
+func (z *Zmey) SkewAt(t uint, pid int, skew Skew) {
+	z.Lock()
+	defer z.Unlock()
+
+	if !z.c.Deterministic {
+		log.Printf("[%4d] SkewAt: Error: not in deterministic mode", pid)
+		return
+	}
+
+	z.schedule(t, func() {
+		z.setSkew(pid, skew)
+	})
+}
+
+func (z *Zmey) setSkew(pid int, skew Skew) {
+	if skew.Drift <= -1 {
+		log.Printf("[%4d] Skew: Error: drift %f should be greater than -1", pid, skew.Drift)
+		return
+	}
+
+	c, ok := z.clocks[pid]
+	if !ok {
+		c = &clock{anchor: z.now, base: float64(z.now)}
+		z.clocks[pid] = c
+	}
+	c.set(z.now, skew)
+
+	// The timers are armed in the time of the process, their deadlines have
+	// to be updated
+	if pack, ok := z.packs[pid]; ok {
+		for _, t := range pack.timers {
+			t.deadline = c.deadline(z.now, t.local)
+		}
+	}
+
+	if z.c.Debug {
+		log.Printf("[%4d] Skew: offset %d drift %f at %d", pid, skew.Offset, skew.Drift, z.now)
+	}
+}
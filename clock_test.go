@@ -0,0 +1,89 @@
+package zmey
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClock(t *testing.T) {
+	var c *clock
+
+	assert.Equal(t, uint(42), c.local(42))
+	assert.Equal(t, uint(50), c.deadline(42, 50))
+	assert.Equal(t, uint(42), c.deadline(42, 30))
+	assert.Equal(t, uint(7), c.duration(7))
+
+	c = &clock{}
+	c.set(0, Skew{Offset: 5, Drift: 0.5})
+
+	assert.Equal(t, uint(5), c.local(0))
+	assert.Equal(t, uint(20), c.local(10))
+	assert.Equal(t, uint(10), c.deadline(0, 20))
+	assert.Equal(t, uint(11), c.deadline(0, 21))
+	assert.Equal(t, uint(15), c.duration(10))
+
+	// The local time keeps increasing continuously after the drift changes
+	c.set(10, Skew{Offset: 5, Drift: -0.5})
+
+	assert.Equal(t, uint(20), c.local(10))
+	assert.Equal(t, uint(25), c.local(20))
+	assert.Equal(t, uint(30), c.deadline(10, 30))
+
+	c.set(20, Skew{Offset: -100})
+
+	assert.Equal(t, uint(0), c.local(20))
+	assert.Equal(t, uint(20), c.deadline(20, 0))
+}
+
+func TestSkew(t *testing.T) {
+	z := NewZmey(&Config{Deterministic: true})
+	z.SetProcess(0, &heartbeatProcess{period: 10})
+	z.SetProcess(1, &heartbeatProcess{period: 10})
+
+	z.Skew(0, Skew{Drift: 1})
+	z.SkewAt(12, 0, Skew{Offset: 100})
+	z.Skew(1, Skew{Offset: 3})
+
+	z.Advance(20)
+	_, traces, err := z.Round(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, map[int][]interface{}{
+		// The clock of process 0 runs twice as fast until 12, then jumps
+		// ahead, which fires the pending timer
+		0: {"heartbeat 1 at 10", "heartbeat 2 at 20", "heartbeat 3 at 124"},
+		1: {"heartbeat 1 at 13", "heartbeat 2 at 23"},
+	}, traces)
+}
+
+func TestSkewTick(t *testing.T) {
+	z := NewZmey(&Config{Deterministic: true})
+	z.SetProcess(0, newRelayProcess(0, 2))
+	z.SetProcess(1, newRelayProcess(1, 2))
+
+	z.Skew(1, Skew{Drift: 0.5})
+	z.Tick(10)
+
+	_, traces, err := z.Round(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, map[int][]interface{}{
+		0: {"0 tick 10"},
+		1: {"1 tick 15"},
+	}, traces)
+}
+
+func TestSkewAtConcurrent(t *testing.T) {
+	z := NewZmey(&Config{})
+	z.SetProcess(0, newRelayProcess(0, 1))
+
+	z.SkewAt(0, 0, Skew{Offset: 5})
+	assert.Empty(t, z.timeline)
+
+	_, _, err := z.Round(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, z.clocks[0])
+}
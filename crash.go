@@ -0,0 +1,112 @@
+package zmey
+
+import (
+	"log"
+)
+
+// Crash stops the process `pid`: nothing is delivered to it until it
+// restarts, its timers are cancelled, and the calls and ticks sent to it are
+// lost. If `dropInbound` is true, the messages buffered for the process are
+// lost as well, including the ones arriving while it's down; otherwise they
+// are delivered after the restart. Crash requires Config.Deterministic. Crash
+// is thread-safe.
+func (z *Zmey) Crash(pid int, dropInbound bool) {
+	z.Lock()
+	defer z.Unlock()
+
+	z.crash(pid, dropInbound)
+}
+
+// CrashAt crashes the process `pid` once the virtual time reaches `t`, see
+// Crash. CrashAt requires Config.Deterministic, otherwise it logs an error
+// and schedules nothing. CrashAt is thread-safe.
+func (z *Zmey) CrashAt(t uint, pid int, dropInbound bool) {
+	z.Lock()
+	defer z.Unlock()
+
+	if !z.c.Deterministic {
+		log.Printf("[%4d] CrashAt: Error: not in deterministic mode", pid)
+		return
+	}
+
+	z.schedule(t, func() {
+		z.crash(pid, dropInbound)
+	})
+}
+
+// Restart replaces the crashed process `pid` by a new instance created by
+// `factoryF`, which is initialized again before anything is delivered to it.
+// Restart requires Config.Deterministic. Restart is thread-safe.
+func (z *Zmey) Restart(pid int, factoryF FactoryFunc) {
+	z.Lock()
+	defer z.Unlock()
+
+	z.restart(pid, factoryF)
+}
+
+// RestartAt restarts the process `pid` once the virtual time reaches `t`, see
+// Restart. RestartAt requires Config.Deterministic, otherwise it logs an
+// error and schedules nothing. RestartAt is thread-safe.
+func (z *Zmey) RestartAt(t uint, pid int, factoryF FactoryFunc) {
+	z.Lock()
+	defer z.Unlock()
+
+	if !z.c.Deterministic {
+		log.Printf("[%4d] RestartAt: Error: not in deterministic mode", pid)
+		return
+	}
+
+	z.schedule(t, func() {
+		if z.restart(pid, factoryF) {
+			// Actions are applied during a Round, the process is started
+			// right away
+			z.initProcess(z.packs[pid])
+		}
+	})
+}
+
+func (z *Zmey) crash(pid int, dropInbound bool) {
+	pack, ok := z.packs[pid]
+	if !ok || !z.c.Deterministic {
+		log.Printf("[%4d] Crash: Error: no such process, or not in deterministic mode", pid)
+		return
+	}
+
+	pack.crashed = true
+	pack.dropInbound = dropInbound
+	pack.timers = nil
+	if pack.storage != nil {
+		pack.storage.crash(pid, z.storagePolicy, z.netRng)
+	}
+	if dropInbound && z.net != nil {
+		z.net.clear(pid)
+	}
+
+	if z.c.Debug {
+		log.Printf("[%4d] Crash: crashed at %d", pid, z.now)
+	}
+}
+
+func (z *Zmey) restart(pid int, factoryF FactoryFunc) bool {
+	pack, ok := z.packs[pid]
+	if !ok || !z.c.Deterministic {
+		log.Printf("[%4d] Restart: Error: no such process, or not in deterministic mode", pid)
+		return false
+	}
+	if !pack.crashed {
+		log.Printf("[%4d] Restart: Error: process is running", pid)
+		return false
+	}
+
+	pack.process = factoryF(pid)
+	pack.isStarted = false
+	pack.membership = nil
+	pack.crashed = false
+	pack.dropInbound = false
+
+	if z.c.Debug {
+		log.Printf("[%4d] Restart: restarted at %d", pid, z.now)
+	}
+
+	return true
+}
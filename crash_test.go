@@ -0,0 +1,88 @@
+package zmey
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCrashRestart(t *testing.T) {
+	z := newTestZmey(&Config{Deterministic: true}, 3, newBeaconProcess)
+	z.CrashAt(15, 1, false)
+	z.RestartAt(35, 1, newBeaconProcess)
+
+	z.Advance(40)
+	_, traces, err := z.Round(context.Background())
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []interface{}{
+		"0 at 10", "1 at 10", "2 at 10",
+		"0 at 20", "2 at 20",
+		"0 at 30", "2 at 30",
+		"0 at 40", "2 at 40",
+	}, traces[0])
+
+	// The messages sent while process 1 was down are delivered after the
+	// restart, in order
+	assert.ElementsMatch(t, []interface{}{
+		"0 at 10", "1 at 10", "2 at 10",
+		"0 at 20", "2 at 20",
+		"0 at 30", "2 at 30",
+		"0 at 40", "2 at 40",
+	}, traces[1])
+	assert.True(t, indexOf(traces[1], "0 at 20") < indexOf(traces[1], "0 at 30"))
+}
+
+func TestCrashDropInbound(t *testing.T) {
+	z := newTestZmey(&Config{Deterministic: true}, 3, newBeaconProcess)
+	z.CrashAt(15, 1, true)
+	z.RestartAt(35, 1, newBeaconProcess)
+
+	z.Advance(40)
+	_, traces, err := z.Round(context.Background())
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []interface{}{
+		"0 at 10", "1 at 10", "2 at 10",
+		"0 at 40", "2 at 40",
+	}, traces[1])
+}
+
+func TestCrashBetweenRounds(t *testing.T) {
+	z := newTestZmey(&Config{Deterministic: true}, 2, newPingProcess, 1)
+	z.Crash(1, false)
+
+	responses, _, err := z.Round(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[int][]interface{}{0: nil, 1: nil}, responses)
+
+	// The ping buffered during the previous Round is answered once process 1
+	// restarts
+	z.Restart(1, newPingProcess)
+
+	responses, _, err = z.Round(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[int][]interface{}{0: {uint(0)}, 1: nil}, responses)
+}
+
+func TestCrashConcurrent(t *testing.T) {
+	z := newTestZmey(&Config{}, 2, newPingProcess, 1)
+	z.CrashAt(0, 1, true)
+	z.RestartAt(0, 1, newPingProcess)
+	assert.Empty(t, z.timeline)
+
+	responses, _, err := z.Round(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[int][]interface{}{0: {uint(0)}, 1: nil}, responses)
+}
+
+func indexOf(items []interface{}, item interface{}) int {
+	for i := range items {
+		if items[i] == item {
+			return i
+		}
+	}
+	return -1
+}
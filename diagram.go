@@ -0,0 +1,120 @@
+package zmey
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// diagramSyntax writes the statements of a sequence diagram in a given
+// language
+type diagramSyntax struct {
+	header      string
+	footer      string
+	participant string
+	arrow       string
+	lost        string
+	note        string
+	escape      func(string) string
+}
+
+var mermaid = diagramSyntax{
+	header:      "sequenceDiagram",
+	participant: "    participant %s as %d",
+	arrow:       "    %s->>%s: %s",
+	lost:        "    %s-x%s: %s",
+	note:        "    Note over %s: %s",
+	escape: strings.NewReplacer(
+		"\n", " ",
+		"#", "#35;",
+		";", "#59;",
+	).Replace,
+}
+
+var plantUML = diagramSyntax{
+	header:      "@startuml",
+	footer:      "@enduml",
+	participant: "participant \"%[2]d\" as %[1]s",
+	arrow:       "%s -> %s : %s",
+	lost:        "%s ->x %s : %s",
+	note:        "note over %s : %s",
+	escape: strings.NewReplacer(
+		"\n", "\\n",
+	).Replace,
+}
+
+// WriteMermaid writes the events as a Mermaid sequence diagram: a lifeline
+// per process, an arrow per delivered message, and notes for the calls,
+// returns, traces, errors and panics. Messages cut by the filter or never
+// delivered are drawn as lost arrows. The events are usually
+// RoundResult.Events, or the ones passed to Zmey.Subscribe.
+func WriteMermaid(w io.Writer, events []Event) error {
+	return writeDiagram(w, events, &mermaid)
+}
+
+// WritePlantUML writes the events as a PlantUML sequence diagram, see
+// WriteMermaid
+func WritePlantUML(w io.Writer, events []Event) error {
+	return writeDiagram(w, events, &plantUML)
+}
+
+func writeDiagram(w io.Writer, events []Event, syntax *diagramSyntax) error {
+	b := bufio.NewWriter(w)
+
+	// A message is lost if it's sent, but neither delivered nor filtered
+	delivered := make(map[int]bool)
+	seen := make(map[int]bool)
+	for _, e := range events {
+		seen[e.Pid] = true
+		switch e.Kind {
+		case EventSend, EventBuffer, EventFault:
+			seen[e.Peer] = true
+		case EventDeliver, EventFilterDrop:
+			seen[e.Peer] = true
+			delivered[e.Msg] = true
+		}
+	}
+
+	pids := make([]int, 0, len(seen))
+	for pid := range seen {
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+
+	fmt.Fprintln(b, syntax.header)
+	for _, pid := range pids {
+		fmt.Fprintf(b, syntax.participant+"\n", alias(pid), pid)
+	}
+
+	for _, e := range events {
+		text := syntax.escape(fmt.Sprintf("%+v", e.Payload))
+		switch e.Kind {
+		case EventDeliver:
+			fmt.Fprintf(b, syntax.arrow+"\n", alias(e.Peer), alias(e.Pid), text)
+		case EventFilterDrop:
+			fmt.Fprintf(b, syntax.lost+"\n", alias(e.Pid), alias(e.Peer), text+" (filtered)")
+		case EventSend:
+			if !delivered[e.Msg] {
+				fmt.Fprintf(b, syntax.lost+"\n", alias(e.Pid), alias(e.Peer), text+" (lost)")
+			}
+		case EventCall, EventReturn, EventTrace, EventFault, EventError, EventPanic:
+			fmt.Fprintf(b, syntax.note+"\n", alias(e.Pid), e.Kind.String()+" "+text)
+		}
+	}
+
+	if syntax.footer != "" {
+		fmt.Fprintln(b, syntax.footer)
+	}
+
+	return b.Flush()
+}
+
+// alias names the lifeline of the process `pid` in a diagram
+func alias(pid int) string {
+	if pid < 0 {
+		return fmt.Sprintf("m%d", -pid)
+	}
+	return fmt.Sprintf("p%d", pid)
+}
@@ -0,0 +1,87 @@
+package zmey
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// diagramEvents are a ping delivered to 1, a ping cut by the filter and a
+// pong lost on the way
+var diagramEvents = []Event{
+	{Seq: 1, Kind: EventCall, Pid: 0, Payload: 1},
+	{Seq: 2, Kind: EventSend, Pid: 0, Peer: 1, Msg: 1, Payload: "ping"},
+	{Seq: 3, Kind: EventBuffer, Pid: 1, Peer: 0, Msg: 1, Payload: "ping"},
+	{Seq: 4, Kind: EventSend, Pid: 0, Peer: 2, Msg: 2, Payload: "ping"},
+	{Seq: 5, Kind: EventFilterDrop, Pid: 0, Peer: 2, Msg: 2, Payload: "ping"},
+	{Seq: 6, Kind: EventDeliver, Pid: 1, Peer: 0, Msg: 1, Payload: "ping"},
+	{Seq: 7, Kind: EventTrace, Pid: 1, Payload: "got; #1\nping"},
+	{Seq: 8, Kind: EventSend, Pid: 1, Peer: 0, Msg: 3, Payload: "pong"},
+	{Seq: 9, Kind: EventReturn, Pid: 1, Payload: 42},
+}
+
+func TestWriteMermaid(t *testing.T) {
+	var b bytes.Buffer
+	require.NoError(t, WriteMermaid(&b, diagramEvents))
+
+	assert.Equal(t, `sequenceDiagram
+    participant p0 as 0
+    participant p1 as 1
+    participant p2 as 2
+    Note over p0: call 1
+    p0-xp2: ping (filtered)
+    p0->>p1: ping
+    Note over p1: trace got#59; #35;1 ping
+    p1-xp0: pong (lost)
+    Note over p1: return 42
+`, b.String())
+}
+
+func TestWritePlantUML(t *testing.T) {
+	var b bytes.Buffer
+	require.NoError(t, WritePlantUML(&b, diagramEvents))
+
+	assert.Equal(t, `@startuml
+participant "0" as p0
+participant "1" as p1
+participant "2" as p2
+note over p0 : call 1
+p0 ->x p2 : ping (filtered)
+p0 -> p1 : ping
+note over p1 : trace got; #1\nping
+p1 ->x p0 : pong (lost)
+note over p1 : return 42
+@enduml
+`, b.String())
+}
+
+func TestDiagramAlias(t *testing.T) {
+	var b bytes.Buffer
+	require.NoError(t, WriteMermaid(&b, []Event{
+		{Kind: EventDeliver, Pid: -273, Peer: 4, Payload: "ping"},
+	}))
+
+	assert.Equal(t, `sequenceDiagram
+    participant m273 as -273
+    participant p4 as 4
+    p4->>m273: ping
+`, b.String())
+}
+
+func TestWriteMermaidRound(t *testing.T) {
+	z := newTestZmey(&Config{Deterministic: true}, 2, newPingProcess, 1)
+	z.Faults(RandomFaults(FaultRates{Drop: 1}))
+	z.c.Events = true
+
+	result, err := z.Run(context.Background())
+	require.NoError(t, err)
+
+	var b bytes.Buffer
+	require.NoError(t, WriteMermaid(&b, result.Events))
+
+	assert.Contains(t, b.String(), "p0-xp1: ping (lost)")
+	assert.Contains(t, b.String(), "Note over p0: fault drop 0 -> 1: ping")
+}
@@ -0,0 +1,177 @@
+package zmey
+
+import (
+	"fmt"
+	"time"
+)
+
+// EventKind tells what happened in an Event
+type EventKind int
+
+// The kinds of events reported during a Round
+const (
+	// EventSend is a message sent by a process
+	EventSend EventKind = iota
+	// EventFilterDrop is a message lost because the filter cut the link
+	EventFilterDrop
+	// EventFault is a fault injected in a message, see Zmey.Faults. Its
+	// payload is the Fault.
+	EventFault
+	// EventBuffer is a message buffered for its recipient. Duplicated
+	// messages are buffered several times.
+	EventBuffer
+	// EventDeliver is a message passed to ReceiveNet of the recipient
+	EventDeliver
+	// EventCall is a call passed to ReceiveCall
+	EventCall
+	// EventReturn is a response returned by a process
+	EventReturn
+	// EventTick is a tick passed to Tick
+	EventTick
+	// EventTimer is a timer passed to ReceiveTimer
+	EventTimer
+	// EventMembership is a membership event passed to ReceiveMembership
+	EventMembership
+	// EventTrace is a trace of a process
+	EventTrace
+	// EventError is an error passed to ReportError
+	EventError
+	// EventPanic is a panic recovered from a process
+	EventPanic
+	// EventDone is the end of the handler of a deliver, call, tick, timer or
+	// membership event. Its payload is the kind of the event handled.
+	EventDone
+)
+
+var eventKindNames = map[EventKind]string{
+	EventSend:       "send",
+	EventFilterDrop: "filter-drop",
+	EventFault:      "fault",
+	EventBuffer:     "buffer",
+	EventDeliver:    "deliver",
+	EventCall:       "call",
+	EventReturn:     "return",
+	EventTick:       "tick",
+	EventTimer:      "timer",
+	EventMembership: "membership",
+	EventTrace:      "trace",
+	EventError:      "error",
+	EventPanic:      "panic",
+	EventDone:       "done",
+}
+
+func (k EventKind) String() string {
+	if name, ok := eventKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("EventKind(%d)", int(k))
+}
+
+// Event is a step of the execution of a Round. Seq orders the events of all
+// the processes, and Time is the virtual time of the event.
+//
+// Pid is the process where the event happens: the sender of a message for
+// send, filter-drop and fault events, its recipient for buffer and deliver
+// events.
+// Peer is the other end of the message. Msg identifies the message in these
+// events, the copies of a duplicated message share it.
+//
+// Clock is the vector clock of the event, if Config.VectorClocks is set.
+// Buffer, filter-drop and fault events carry the clock of the send, done
+// events carry none.
+//
+// Wall is the wall-clock time elapsed since the beginning of the Round. It
+// is the only field which differs between two runs of a deterministic Round.
+type Event struct {
+	Seq     int
+	Time    uint
+	Wall    time.Duration
+	Kind    EventKind
+	Pid     int
+	Peer    int
+	Msg     int
+	Payload interface{}
+	Clock   VectorClock
+}
+
+func (e Event) String() string {
+	switch e.Kind {
+	case EventSend, EventFilterDrop, EventFault:
+		return fmt.Sprintf("#%d @%d %s %d -> %d msg %d: %+v", e.Seq, e.Time, e.Kind, e.Pid, e.Peer, e.Msg, e.Payload)
+	case EventBuffer, EventDeliver:
+		return fmt.Sprintf("#%d @%d %s %d <- %d msg %d: %+v", e.Seq, e.Time, e.Kind, e.Pid, e.Peer, e.Msg, e.Payload)
+	default:
+		return fmt.Sprintf("#%d @%d %s %d: %+v", e.Seq, e.Time, e.Kind, e.Pid, e.Payload)
+	}
+}
+
+// EventFunc receives the events of a Round, see Zmey.Subscribe
+type EventFunc func(Event)
+
+// Subscribe adds a function receiving every event of the following Rounds.
+// The function is called by one goroutine at a time, in the order of the
+// events, before the Round ends. It must not call Zmey. Subscribe is
+// thread-safe.
+func (z *Zmey) Subscribe(f EventFunc) {
+	z.Lock()
+	defer z.Unlock()
+
+	z.subscribers = append(z.subscribers, f)
+}
+
+// observed tells if the events are recorded or listened to
+func (z *Zmey) observed() bool {
+	return z.c.Events || len(z.subscribers) > 0
+}
+
+// emit numbers the event, records it if Config.Events is set and passes it
+// to the subscribers. emit is thread-safe.
+func (z *Zmey) emit(e Event) {
+	if !z.observed() {
+		return
+	}
+
+	z.resultLock.Lock()
+	defer z.resultLock.Unlock()
+
+	z.eventSeq++
+	e.Seq = z.eventSeq
+	e.Time = z.now
+	e.Wall = time.Since(z.started)
+
+	if z.c.Events {
+		z.result.Events = append(z.result.Events, e)
+	}
+	if len(z.subscribers) == 0 {
+		return
+	}
+
+	// The subscribers are called without the lock, by the first goroutine
+	// emitting, which also passes the events queued meanwhile by the others
+	z.notified = append(z.notified, e)
+	if z.notifying {
+		return
+	}
+	z.notifying = true
+	defer func() {
+		z.notifying = false
+	}()
+	for len(z.notified) > 0 {
+		events := z.notified
+		z.notified = nil
+		z.notify(events, append([]EventFunc(nil), z.subscribers...))
+	}
+}
+
+// notify passes the events to the subscribers. It is called with resultLock
+// held, and releases it meanwhile.
+func (z *Zmey) notify(events []Event, subscribers []EventFunc) {
+	z.resultLock.Unlock()
+	defer z.resultLock.Lock()
+
+	for _, e := range events {
+		for _, f := range subscribers {
+			f(e)
+		}
+	}
+}
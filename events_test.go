@@ -0,0 +1,133 @@
+package zmey
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvents(t *testing.T) {
+	z := newTestZmey(&Config{Deterministic: true, Events: true}, 2, newPingProcess, 1)
+	z.Latency(FixedLatency(5))
+
+	result, err := z.Run(context.Background())
+	require.NoError(t, err)
+
+	// Wall is the only field which changes from run to run, it grows
+	events := result.Events
+	for i := range events {
+		if i > 0 {
+			assert.True(t, events[i].Wall >= events[i-1].Wall)
+		}
+		events[i].Wall = 0
+	}
+
+	assert.Equal(t, []Event{
+		{Seq: 1, Time: 0, Kind: EventCall, Pid: 0, Payload: 1},
+		{Seq: 2, Time: 0, Kind: EventSend, Pid: 0, Peer: 1, Msg: 1, Payload: "ping"},
+		{Seq: 3, Time: 0, Kind: EventBuffer, Pid: 1, Peer: 0, Msg: 1, Payload: "ping"},
+		{Seq: 4, Time: 0, Kind: EventDone, Pid: 0, Payload: EventCall},
+		{Seq: 5, Time: 5, Kind: EventDeliver, Pid: 1, Peer: 0, Msg: 1, Payload: "ping"},
+		{Seq: 6, Time: 5, Kind: EventTrace, Pid: 1, Payload: uint(5)},
+		{Seq: 7, Time: 5, Kind: EventSend, Pid: 1, Peer: 0, Msg: 2, Payload: "pong"},
+		{Seq: 8, Time: 5, Kind: EventBuffer, Pid: 0, Peer: 1, Msg: 2, Payload: "pong"},
+		{Seq: 9, Time: 5, Kind: EventDone, Pid: 1, Payload: EventDeliver},
+		{Seq: 10, Time: 10, Kind: EventDeliver, Pid: 0, Peer: 1, Msg: 2, Payload: "pong"},
+		{Seq: 11, Time: 10, Kind: EventReturn, Pid: 0, Payload: uint(10)},
+		{Seq: 12, Time: 10, Kind: EventDone, Pid: 0, Payload: EventDeliver},
+	}, events)
+
+	assert.Equal(t, "#4 @5 deliver 1 <- 0 msg 1: ping", Event{
+		Seq: 4, Time: 5, Kind: EventDeliver, Pid: 1, Peer: 0, Msg: 1, Payload: "ping",
+	}.String())
+
+	// Events are not carried over to the next Round, but Seq and Msg keep
+	// growing
+	z.Inject(callFirst(1))
+	result, err = z.Run(context.Background())
+	require.NoError(t, err)
+
+	require.Len(t, result.Events, 12)
+	assert.Equal(t, 13, result.Events[0].Seq)
+	assert.Equal(t, 3, result.Events[1].Msg)
+}
+
+func TestSubscribe(t *testing.T) {
+	z := newTestZmey(&Config{}, 3, newPingProcess, 1, 2)
+	z.Filter(func(from, to int) bool {
+		return to != 2
+	})
+
+	var lock sync.Mutex
+	var events []Event
+	z.Subscribe(func(e Event) {
+		lock.Lock()
+		defer lock.Unlock()
+		events = append(events, e)
+	})
+
+	result, err := z.Run(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, result.Events)
+
+	kinds := map[EventKind]int{}
+	seen := map[int][]EventKind{}
+	for i, e := range events {
+		assert.Equal(t, i+1, e.Seq)
+		kinds[e.Kind]++
+		if e.Msg != 0 {
+			seen[e.Msg] = append(seen[e.Msg], e.Kind)
+		}
+	}
+
+	assert.Equal(t, map[EventKind]int{
+		EventCall:       2,
+		EventSend:       3,
+		EventFilterDrop: 1,
+		EventBuffer:     2,
+		EventDeliver:    2,
+		EventTrace:      1,
+		EventReturn:     1,
+		EventDone:       4,
+	}, kinds)
+
+	// Each message is sent, then buffered and delivered, or dropped
+	for _, msg := range seen {
+		if msg[1] == EventFilterDrop {
+			assert.Equal(t, []EventKind{EventSend, EventFilterDrop}, msg)
+			continue
+		}
+		assert.Equal(t, []EventKind{EventSend, EventBuffer, EventDeliver}, msg)
+	}
+}
+
+func TestSubscribeUnlocked(t *testing.T) {
+	z := NewZmey(&Config{})
+
+	var seqs []int
+	emittedC := make(chan struct{})
+	z.Subscribe(func(e Event) {
+		seqs = append(seqs, e.Seq)
+		if e.Seq != 1 {
+			return
+		}
+		// Another goroutine emits while the first event is being passed,
+		// its event is passed next
+		go func() {
+			z.emit(Event{Kind: EventTrace})
+			close(emittedC)
+		}()
+		select {
+		case <-emittedC:
+		case <-time.After(time.Second):
+			t.Error("emit blocked by a subscriber")
+		}
+	})
+
+	z.emit(Event{Kind: EventTrace})
+	assert.Equal(t, []int{1, 2}, seqs)
+}
@@ -8,7 +8,6 @@ import (
 type Client struct {
 	pid             int
 	pendingRequests []TimestampedCall
-	serverPid       int
 	time            uint
 	timeout         uint
 
@@ -16,6 +15,7 @@ type Client struct {
 	returnF func(payload interface{})
 	traceF  func(payload interface{})
 	errorF  func(error)
+	api     zmey.API
 }
 
 // Call represents the data passed from injector to client.
@@ -37,15 +37,20 @@ type TimestampedCall struct {
 	Timestamp uint
 }
 
-// NewClient creates an instance of a Client
-func NewClient(pid, serverPid int, timeout uint) zmey.Process {
+// NewClient creates an instance of a Client. The client sends its requests to
+// the processes of the group "servers".
+func NewClient(pid int, timeout uint) zmey.Process {
 	return &Client{
-		pid:       pid,
-		serverPid: serverPid,
-		timeout:   timeout,
+		pid:     pid,
+		timeout: timeout,
 	}
 }
 
+// BindAPI implements APIProcess.BindAPI
+func (c *Client) BindAPI(api zmey.API) {
+	c.api = api
+}
+
 // Init initializes an instance of a Client
 func (c *Client) Init(
 	sendF func(to int, payload interface{}),
@@ -96,9 +101,15 @@ func (c *Client) ReceiveCall(call interface{}) {
 	t = t.Fork("client call %d", msg.ID)
 	c.traceF(t.Logf("received"))
 
+	servers := c.api.Group("servers")
+	if len(servers) == 0 {
+		c.errorF(t.Errorf("no servers"))
+		return
+	}
+
 	c.pendingRequests = append(c.pendingRequests, TimestampedCall{Call: msg, Timestamp: c.time})
 
-	c.sendF(c.serverPid, Request{ID: msg.ID, Payload: msg.Payload})
+	c.sendF(servers[msg.ID%len(servers)], Request{ID: msg.ID, Payload: msg.Payload})
 }
 
 // Tick implements Process.Tick
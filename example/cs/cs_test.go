@@ -23,8 +23,10 @@ func TestDefault(t *testing.T) {
 	})
 
 	z.SetProcess(serverPid, NewServer(serverPid))
-	z.SetProcess(clientAPid, NewClient(clientAPid, serverPid, timeout))
-	z.SetProcess(clientBPid, NewClient(clientBPid, serverPid, timeout))
+	z.SetProcess(clientAPid, NewClient(clientAPid, timeout))
+	z.SetProcess(clientBPid, NewClient(clientBPid, timeout))
+	z.SetGroup("servers", []int{serverPid})
+	z.SetGroup("clients", []int{clientAPid, clientBPid})
 
 	requests := map[int][]Call{
 		clientAPid: {
@@ -30,14 +30,14 @@ func TestDefault(t *testing.T) {
 
 	go func() {
 		for msg := range z.Status() {
-			log.Printf(msg)
+			log.Print(msg)
 			time.Sleep(250 * time.Millisecond)
 		}
 	}()
 
 	go func() {
 		for msg := range z.BufferStats() {
-			log.Printf("\n" + msg)
+			log.Print("\n" + msg)
 			time.Sleep(1 * time.Second)
 		}
 	}()
@@ -0,0 +1,306 @@
+package zmey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var (
+	// ErrInvariantViolated is returned if the state of the system does not
+	// satisfy the invariant of a Scenario.
+	ErrInvariantViolated = errors.New("invariant violated")
+	// ErrNondeterministic is returned by Explore if the same schedule does not
+	// lead to the same choices twice, e.g. because the processes depend on
+	// wall-clock time or on a global random generator.
+	ErrNondeterministic = errors.New("scenario is not deterministic")
+)
+
+// InvariantFunc checks the state of the system. It receives the responses and
+// traces collected so far, and returns an error if the state is invalid.
+// The maps and slices must not be modified.
+type InvariantFunc func(responses, traces map[int][]interface{}) error
+
+// Scenario describes a single deterministic Round that can be executed again
+// and again from scratch: every execution creates fresh processes with
+// Factory.
+type Scenario struct {
+	// Pids lists the ids of the processes
+	Pids []int
+	// Factory creates the processes
+	Factory FactoryFunc
+	// Inject (optional) injects the calls, see Zmey.Inject
+	Inject InjectFunc
+	// Filter (optional) cuts communication channels, see Zmey.Filter
+	Filter FilterFunc
+	// Tick (optional) is sent to all the processes, see Zmey.Tick
+	Tick uint
+	// Advance (optional) lets the virtual time move forward, see Zmey.Advance
+	Advance uint
+	// Invariant (optional) is checked before the first step and after every
+	// step of the Round
+	Invariant InvariantFunc
+}
+
+// ExploreConfig tunes Explore
+type ExploreConfig struct {
+	// MaxDepth bounds the number of steps of a schedule, longer schedules are
+	// cut. Zero means no limit.
+	MaxDepth int
+	// MaxSchedules bounds the number of explored schedules. Zero means no
+	// limit.
+	MaxSchedules int
+	// NoReduction disables partial-order reduction, so that every
+	// interleaving is executed, including the equivalent ones
+	NoReduction bool
+}
+
+// ExploreResult summarizes the exploration
+type ExploreResult struct {
+	// Schedules is the number of executed schedules
+	Schedules int
+	// Truncated is the number of schedules cut by MaxDepth
+	Truncated int
+	// Pruned is the number of branches skipped by partial-order reduction:
+	// each of them only leads to schedules equivalent to explored ones
+	Pruned int
+	// Complete is true if every schedule has been explored
+	Complete bool
+	// Violation is the error returned by the invariant, nil if none of the
+	// schedules violated it
+	Violation error
+	// Replay is the schedule which violated the invariant. It can be passed
+	// to Config.Replay to reproduce the violation with Scenario.Run.
+	Replay *Replay
+}
+
+// Run executes the scenario once, as a deterministic Round configured by `c`.
+// It returns the responses and traces of the Round, or an error wrapping
+// ErrInvariantViolated if the invariant does not hold. Like Round, it returns
+// a FailedError along with the responses and traces if processes reported
+// errors or panicked.
+func (s *Scenario) Run(ctx context.Context, c *Config) (map[int][]interface{}, map[int][]interface{}, error) {
+	z := s.zmey(c)
+
+	z.Lock()
+	defer z.Unlock()
+
+	choose, drops := z.chooser()
+
+	if err := z.roundDeterministic(ctx, s.checked(z, choose), drops); err != nil {
+		return nil, nil, err
+	}
+
+	result := z.collected()
+
+	return result.Responses(), result.Traces(), result.failed()
+}
+
+// zmey creates an instance of Zmey running the scenario
+func (s *Scenario) zmey(c *Config) *Zmey {
+	config := *c
+	config.Deterministic = true
+
+	z := NewZmey(&config)
+	for _, pid := range s.Pids {
+		z.SetProcess(pid, s.Factory(pid))
+	}
+	if s.Inject != nil {
+		z.Inject(s.Inject)
+	}
+	if s.Filter != nil {
+		z.Filter(s.Filter)
+	}
+	if s.Tick != 0 {
+		z.Tick(s.Tick)
+	}
+	if s.Advance != 0 {
+		z.Advance(s.Advance)
+	}
+
+	return z
+}
+
+// checked wraps chooseFunc to check the invariant before each step
+func (s *Scenario) checked(z *Zmey, choose chooseFunc) chooseFunc {
+	if s.Invariant == nil {
+		return choose
+	}
+
+	return func(steps []Step) (int, error) {
+		result := z.current()
+
+		if err := s.Invariant(result.Responses(), result.Traces()); err != nil {
+			return 0, fmt.Errorf("%w: %s", ErrInvariantViolated, err)
+		}
+
+		return choose(steps)
+	}
+}
+
+// exploreNode is a choice point of the depth-first search. `sleep` is the
+// sleep set of the node: the steps that need not be tried, since they have
+// already been explored in an equivalent order.
+type exploreNode struct {
+	steps []Step
+	sleep []Step
+	next  int
+}
+
+// candidate returns the index of the first step starting from `i` that is
+// not in the sleep set, or -1 if there is none
+func (n *exploreNode) candidate(i int) int {
+	for ; i < len(n.steps); i++ {
+		if !containsStep(n.sleep, n.steps[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// child returns the sleep set of the node reached by the current step: the
+// steps asleep or already explored at this node, which commute with it
+func (n *exploreNode) child() []Step {
+	current := n.steps[n.next]
+	sleep := []Step{}
+
+	for _, st := range n.sleep {
+		if independent(st, current) {
+			sleep = append(sleep, st)
+		}
+	}
+	for _, st := range n.steps[:n.next] {
+		if !containsStep(n.sleep, st) && independent(st, current) {
+			sleep = append(sleep, st)
+		}
+	}
+
+	return sleep
+}
+
+// independent tells if two steps commute. Executing a step only changes the
+// state of the receiving process, and appends messages to the queues, so
+// deliveries to different processes commute.
+func independent(a, b Step) bool {
+	return a.Pid != b.Pid
+}
+
+func containsStep(steps []Step, st Step) bool {
+	for i := range steps {
+		if steps[i] == st {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// errDepth is returned by the explorer's chooseFunc if the schedule is cut
+	errDepth = errors.New("maximum depth reached")
+	// errAsleep is returned by the explorer's chooseFunc if all the enabled
+	// steps are asleep, i.e. the schedule is equivalent to an explored one
+	errAsleep = errors.New("all steps are asleep")
+)
+
+// Explore runs a depth-first search over all the schedules of the scenario:
+// at every step, each of the pending messages, calls and ticks is tried in
+// turn. The search stops at the first schedule violating the invariant.
+// Since the processes cannot be copied, every schedule is executed from
+// scratch, and the processes must be deterministic.
+//
+// Unless disabled, the search is pruned with sleep sets: deliveries to
+// different processes commute, so only one order of them is explored. A nil
+// config is the zero ExploreConfig.
+func Explore(ctx context.Context, s *Scenario, c *ExploreConfig) (*ExploreResult, error) {
+	if c == nil {
+		c = &ExploreConfig{}
+	}
+
+	result := ExploreResult{}
+	stack := []*exploreNode{}
+
+	for {
+		if c.MaxSchedules != 0 && result.Schedules == c.MaxSchedules {
+			return &result, nil
+		}
+
+		z := s.zmey(&Config{})
+		var depth int
+
+		choose := func(steps []Step) (int, error) {
+			if depth < len(stack) {
+				node := stack[depth]
+				if !reflect.DeepEqual(node.steps, steps) {
+					return 0, fmt.Errorf("%w: expected %v, got %v", ErrNondeterministic, node.steps, steps)
+				}
+				depth++
+				return node.next, nil
+			}
+			if len(steps) == 0 {
+				return 0, nil
+			}
+			if c.MaxDepth != 0 && depth == c.MaxDepth {
+				return 0, errDepth
+			}
+
+			node := &exploreNode{steps: steps}
+			if depth > 0 && !c.NoReduction {
+				node.sleep = stack[depth-1].child()
+			}
+			for i := range steps {
+				if containsStep(node.sleep, steps[i]) {
+					result.Pruned++
+				}
+			}
+
+			node.next = node.candidate(0)
+			if node.next == -1 {
+				return 0, errAsleep
+			}
+
+			stack = append(stack, node)
+			depth++
+			return node.next, nil
+		}
+
+		z.Lock()
+		err := z.roundDeterministic(ctx, s.checked(z, choose), nil)
+		z.Unlock()
+
+		switch {
+		case err == nil:
+			result.Schedules++
+		case errors.Is(err, errAsleep):
+		case errors.Is(err, errDepth):
+			result.Schedules++
+			result.Truncated++
+		case errors.Is(err, ErrInvariantViolated):
+			result.Schedules++
+			result.Violation = err
+			result.Replay = &Replay{
+				Rounds: []Schedule{{
+					Steps:   z.replay.Rounds[0].Steps,
+					Partial: true,
+				}},
+			}
+			return &result, nil
+		default:
+			return &result, err
+		}
+
+		// Backtrack to the deepest choice point with untried steps
+		for len(stack) > 0 {
+			node := stack[len(stack)-1]
+			if next := node.candidate(node.next + 1); next != -1 {
+				node.next = next
+				break
+			}
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			result.Complete = result.Truncated == 0
+			return &result, nil
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package zmey
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// collectorProcess sends each call to process 0, which returns the payload
+// of each message it receives.
+type collectorProcess struct {
+	sendF   func(to int, payload interface{})
+	returnF func(payload interface{})
+}
+
+func newCollectorProcess(int) Process {
+	return &collectorProcess{}
+}
+
+func (p *collectorProcess) Init(
+	sendF func(to int, payload interface{}),
+	returnF func(payload interface{}),
+	traceF func(payload interface{}),
+	errorF func(error),
+) {
+	p.sendF = sendF
+	p.returnF = returnF
+}
+
+func (p *collectorProcess) ReceiveNet(from int, payload interface{}) {
+	p.returnF(payload)
+}
+
+func (p *collectorProcess) ReceiveCall(payload interface{}) {
+	p.sendF(0, payload)
+}
+
+func (p *collectorProcess) Tick(uint) {}
+
+func newCollectorScenario(senders int) *Scenario {
+	pids := []int{0}
+	for pid := 1; pid <= senders; pid++ {
+		pids = append(pids, pid)
+	}
+
+	return &Scenario{
+		Pids:    pids,
+		Factory: newCollectorProcess,
+		Inject: func(pid int, c Client) {
+			if pid != 0 {
+				c.Call(pid)
+			}
+		},
+	}
+}
+
+func TestExploreComplete(t *testing.T) {
+	s := newCollectorScenario(2)
+
+	result, err := Explore(context.Background(), s, &ExploreConfig{NoReduction: true})
+	require.NoError(t, err)
+
+	// Two chains of two events each (call, then delivery) can be interleaved
+	// in six ways
+	assert.Equal(t, 6, result.Schedules)
+	assert.Equal(t, 0, result.Pruned)
+	assert.True(t, result.Complete)
+	assert.NoError(t, result.Violation)
+	assert.Nil(t, result.Replay)
+}
+
+func TestExploreReduction(t *testing.T) {
+	s := newCollectorScenario(2)
+
+	result, err := Explore(context.Background(), s, &ExploreConfig{})
+	require.NoError(t, err)
+
+	// Only the order of deliveries to process 0 matters
+	assert.Equal(t, 2, result.Schedules)
+	assert.Equal(t, 3, result.Pruned)
+	assert.True(t, result.Complete)
+
+	s = newCollectorScenario(4)
+
+	result, err = Explore(context.Background(), s, &ExploreConfig{})
+	require.NoError(t, err)
+
+	assert.Equal(t, 24, result.Schedules)
+	assert.True(t, result.Complete)
+}
+
+func TestExploreNilConfig(t *testing.T) {
+	s := newCollectorScenario(2)
+
+	result, err := Explore(context.Background(), s, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, result.Schedules)
+	assert.True(t, result.Complete)
+}
+
+func TestExploreViolation(t *testing.T) {
+	s := newCollectorScenario(2)
+	s.Invariant = func(responses, traces map[int][]interface{}) error {
+		if len(responses[0]) > 0 && responses[0][0] != 1 {
+			return errors.New("process 1 is not the first")
+		}
+		return nil
+	}
+
+	result, err := Explore(context.Background(), s, &ExploreConfig{})
+	require.NoError(t, err)
+
+	require.Error(t, result.Violation)
+	assert.True(t, errors.Is(result.Violation, ErrInvariantViolated))
+	require.NotNil(t, result.Replay)
+
+	_, _, err = s.Run(context.Background(), &Config{Replay: result.Replay})
+	assert.True(t, errors.Is(err, ErrInvariantViolated), "unexpected error %v", err)
+}
+
+func TestExploreLimits(t *testing.T) {
+	s := newCollectorScenario(3)
+
+	result, err := Explore(context.Background(), s, &ExploreConfig{MaxSchedules: 10, NoReduction: true})
+	require.NoError(t, err)
+	assert.Equal(t, 10, result.Schedules)
+	assert.False(t, result.Complete)
+
+	result, err = Explore(context.Background(), s, &ExploreConfig{MaxDepth: 2, NoReduction: true})
+	require.NoError(t, err)
+	// Only the first two steps are explored: a call, then any of the two
+	// remaining calls or the delivery of the first one
+	assert.Equal(t, 9, result.Schedules)
+	assert.Equal(t, 9, result.Truncated)
+	assert.False(t, result.Complete)
+}
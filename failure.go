@@ -0,0 +1,115 @@
+package zmey
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FailedError is returned by Round and Run if processes reported errors with
+// API.ReportError or panicked during the Round. It wraps ErrProcessFailed.
+type FailedError struct {
+	// Errors and Panics are indexed by process id
+	Errors map[int][]Entry
+	Panics map[int][]Entry
+	// Aborted tells that the first failure ended the Round before all the
+	// events were processed, see Config.AbortOnError
+	Aborted bool
+}
+
+func (e *FailedError) Error() string {
+	var b strings.Builder
+
+	b.WriteString(ErrProcessFailed.Error())
+	if e.Aborted {
+		b.WriteString(" (round aborted)")
+	}
+	for _, pid := range e.pids() {
+		for _, entry := range e.Errors[pid] {
+			fmt.Fprintf(&b, "\n[%4d] error at %d: %v", pid, entry.Time, entry.Payload)
+		}
+		for _, entry := range e.Panics[pid] {
+			fmt.Fprintf(&b, "\n[%4d] panic at %d: %v", pid, entry.Time, entry.Payload)
+		}
+	}
+
+	return b.String()
+}
+
+// Unwrap returns ErrProcessFailed
+func (e *FailedError) Unwrap() error {
+	return ErrProcessFailed
+}
+
+func (e *FailedError) pids() []int {
+	pids := []int{}
+	for pid := range e.Errors {
+		pids = append(pids, pid)
+	}
+	for pid := range e.Panics {
+		if _, ok := e.Errors[pid]; !ok {
+			pids = append(pids, pid)
+		}
+	}
+	sort.Ints(pids)
+	return pids
+}
+
+// failed returns a FailedError if any process of the result reported an
+// error or panicked, nil otherwise
+func (r *RoundResult) failed() error {
+	e := FailedError{
+		Errors:  make(map[int][]Entry),
+		Panics:  make(map[int][]Entry),
+		Aborted: r.aborted,
+	}
+
+	for pid, p := range r.Processes {
+		if len(p.Errors) > 0 {
+			e.Errors[pid] = p.Errors
+		}
+		if len(p.Panics) > 0 {
+			e.Panics[pid] = p.Panics
+		}
+	}
+
+	if len(e.Errors) == 0 && len(e.Panics) == 0 {
+		return nil
+	}
+
+	return &e
+}
+
+// TB is the part of testing.TB used by RoundT. It keeps the testing package
+// out of the binaries linking zmey.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+}
+
+// RoundT runs Round on behalf of the test `tb`, usually a *testing.T. Each
+// error and panic of the processes fails the test, and so does any other
+// error returned by Round, which also stops the test.
+func (z *Zmey) RoundT(tb TB, ctx context.Context) (map[int][]interface{}, map[int][]interface{}) {
+	tb.Helper()
+
+	responses, traces, err := z.Round(ctx)
+	if e, ok := err.(*FailedError); ok {
+		for _, pid := range e.pids() {
+			for _, entry := range e.Errors[pid] {
+				tb.Errorf("process %d reported an error at %d: %v", pid, entry.Time, entry.Payload)
+			}
+			for _, entry := range e.Panics[pid] {
+				tb.Errorf("process %d panicked at %d: %v", pid, entry.Time, entry.Payload)
+			}
+		}
+		return responses, traces
+	}
+	if err != nil {
+		tb.Fatalf("round failed: %s", err)
+	}
+
+	return responses, traces
+}
@@ -0,0 +1,122 @@
+package zmey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingTB records the failures of a test instead of reporting them
+type recordingTB struct {
+	errors []string
+	fatal  bool
+}
+
+func (tb *recordingTB) Helper() {}
+
+func (tb *recordingTB) Errorf(format string, args ...interface{}) {
+	tb.errors = append(tb.errors, fmt.Sprintf(format, args...))
+}
+
+func (tb *recordingTB) Fatalf(format string, args ...interface{}) {
+	tb.Errorf(format, args...)
+	tb.fatal = true
+}
+
+func TestRoundFailed(t *testing.T) {
+	z := newTestZmey(&Config{Deterministic: true}, 2, newFaultyProcess, "error", "ok", "panic")
+
+	responses, _, err := z.Round(context.Background())
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrProcessFailed))
+	assert.Equal(t, map[int][]interface{}{0: nil, 1: nil}, responses)
+
+	e, ok := err.(*FailedError)
+	require.True(t, ok)
+	assert.Equal(t, map[int][]Entry{0: {{Seq: 1, Payload: errors.New("boom")}}}, e.Errors)
+	assert.Equal(t, map[int][]Entry{0: {{Seq: 2, Payload: "boom"}}}, e.Panics)
+	assert.False(t, e.Aborted)
+	assert.Equal(t, "process failed\n[   0] error at 0: boom\n[   0] panic at 0: boom", e.Error())
+}
+
+func TestRoundAbortOnError(t *testing.T) {
+	z := newTestZmey(&Config{Deterministic: true, AbortOnError: true}, 2, newFaultyProcess, "error", "panic")
+
+	_, _, err := z.Round(context.Background())
+	require.Error(t, err)
+
+	e := err.(*FailedError)
+	assert.True(t, e.Aborted)
+	assert.Len(t, e.Errors[0], 1)
+	assert.Empty(t, e.Panics)
+	assert.True(t, z.Replay().Rounds[0].Partial)
+	assert.Len(t, z.Replay().Rounds[0].Steps, 1)
+
+	// The next Round starts afresh
+	z.Inject(func(pid int, c Client) {
+		c.Call("ok")
+	})
+	_, _, err = z.Round(context.Background())
+	assert.NoError(t, err)
+}
+
+func TestRoundAbortOnErrorConcurrent(t *testing.T) {
+	z := newTestZmey(&Config{AbortOnError: true}, 2, newFaultyProcess, "panic", "ok")
+
+	ctx, cancelF := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancelF()
+
+	_, _, err := z.Round(ctx)
+	require.Error(t, err)
+
+	e := err.(*FailedError)
+	assert.True(t, e.Aborted)
+	assert.Equal(t, "boom", e.Panics[0][0].Payload)
+}
+
+func TestRoundAbortOnLastEvent(t *testing.T) {
+	for _, deterministic := range []bool{false, true} {
+		z := newTestZmey(&Config{Deterministic: deterministic, AbortOnError: true}, 2, newFaultyProcess, "ok", "error")
+
+		_, _, err := z.Round(context.Background())
+		require.Error(t, err)
+
+		// Nothing was left when the failure happened
+		e := err.(*FailedError)
+		assert.False(t, e.Aborted, "deterministic=%t", deterministic)
+		assert.Len(t, e.Errors[0], 1)
+		if deterministic {
+			assert.False(t, z.Replay().Rounds[0].Partial)
+		}
+	}
+}
+
+func TestRoundT(t *testing.T) {
+	tb := &recordingTB{}
+	z := newTestZmey(&Config{Deterministic: true}, 2, newFaultyProcess, "error", "panic")
+
+	z.RoundT(tb, context.Background())
+	assert.Equal(t, []string{
+		"process 0 reported an error at 0: boom",
+		"process 0 panicked at 0: boom",
+	}, tb.errors)
+	assert.False(t, tb.fatal)
+
+	tb = &recordingTB{}
+	z.Inject(func(pid int, c Client) {
+		c.Call("ok")
+	})
+	z.RoundT(tb, context.Background())
+	assert.Empty(t, tb.errors)
+
+	tb = &recordingTB{}
+	ctx, cancelF := context.WithCancel(context.Background())
+	cancelF()
+	z.RoundT(tb, ctx)
+	assert.True(t, tb.fatal)
+}
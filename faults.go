@@ -0,0 +1,96 @@
+package zmey
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// FaultKind tells which fault is injected in a message
+type FaultKind int
+
+// Faults injected by FaultFunc
+const (
+	FaultDrop FaultKind = iota
+	FaultDuplicate
+	FaultCorrupt
+)
+
+var faultKindNames = map[FaultKind]string{
+	FaultDrop:      "drop",
+	FaultDuplicate: "duplicate",
+	FaultCorrupt:   "corrupt",
+}
+
+func (k FaultKind) String() string {
+	if name, ok := faultKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("FaultKind(%d)", int(k))
+}
+
+// Fault is recorded in the result of the sender whenever a fault is injected
+// in one of its messages, see ProcessResult.Faults and EventFault
+type Fault struct {
+	Kind FaultKind
+	From int
+	To   int
+	// Payload is the message as it was sent
+	Payload interface{}
+	// Corrupted is the payload delivered instead, for FaultCorrupt
+	Corrupted interface{}
+}
+
+func (f Fault) String() string {
+	if f.Kind == FaultCorrupt {
+		return fmt.Sprintf("%s %d -> %d: %v => %v", f.Kind, f.From, f.To, f.Payload, f.Corrupted)
+	}
+	return fmt.Sprintf("%s %d -> %d: %v", f.Kind, f.From, f.To, f.Payload)
+}
+
+// Fate tells what happens to a message in the network
+type Fate struct {
+	// Drop loses the message, the other fields are ignored
+	Drop bool
+	// Corrupt delivers Payload instead of the original message
+	Corrupt bool
+	Payload interface{}
+	// Duplicates is the number of extra copies of the message delivered
+	Duplicates int
+}
+
+// FaultFunc decides the fate of the message `payload` sent from process
+// `from` to process `to`. `r` is the pseudo-random generator of the network,
+// so that the faults are reproducible.
+type FaultFunc func(from, to int, payload interface{}, r *rand.Rand) Fate
+
+// FaultRates are the probabilities of the faults injected by RandomFaults
+type FaultRates struct {
+	// Drop is the probability to lose a message
+	Drop float64
+	// Duplicate is the probability to deliver a message twice
+	Duplicate float64
+	// Corrupt is the probability to replace the payload of a message by the
+	// result of CorruptF. Messages are not corrupted if CorruptF is nil.
+	Corrupt  float64
+	CorruptF func(payload interface{}, r *rand.Rand) interface{}
+}
+
+// RandomFaults injects faults independently in each message, with the same
+// probabilities for every link
+func RandomFaults(rates FaultRates) FaultFunc {
+	return func(from, to int, payload interface{}, r *rand.Rand) Fate {
+		var fate Fate
+		if r.Float64() < rates.Drop {
+			fate.Drop = true
+			return fate
+		}
+		if rates.CorruptF != nil && r.Float64() < rates.Corrupt {
+			fate.Corrupt = true
+			fate.Payload = rates.CorruptF(payload, r)
+		}
+		if r.Float64() < rates.Duplicate {
+			fate.Duplicates = 1
+		}
+		return fate
+	}
+}
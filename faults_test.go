@@ -0,0 +1,91 @@
+package zmey
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaultsDrop(t *testing.T) {
+	z := newTestZmey(&Config{Deterministic: true, Events: true}, 2, newPingProcess, 1)
+	z.Faults(RandomFaults(FaultRates{Drop: 1}))
+
+	result, err := z.Run(context.Background())
+	require.NoError(t, err)
+
+	fault := Fault{Kind: FaultDrop, From: 0, To: 1, Payload: "ping"}
+	assert.Equal(t, map[int][]interface{}{0: nil, 1: nil}, result.Responses())
+	assert.Equal(t, map[int][]interface{}{0: nil, 1: nil}, result.Traces())
+	assert.Equal(t, []interface{}{fault}, payloads(result.Processes[0].Faults))
+	assert.Nil(t, result.Processes[1].Faults)
+
+	require.Len(t, result.Events, 4)
+	e := result.Events[2]
+	e.Wall = 0
+	assert.Equal(t, Event{Seq: 3, Kind: EventFault, Pid: 0, Peer: 1, Msg: 1, Payload: fault}, e)
+}
+
+func TestFaultsDuplicate(t *testing.T) {
+	z := newTestZmey(&Config{Deterministic: true}, 2, newPingProcess, 1)
+	z.Faults(RandomFaults(FaultRates{Duplicate: 1}))
+
+	result, err := z.Run(context.Background())
+	require.NoError(t, err)
+
+	// Both pings are answered, and every pong is duplicated
+	assert.Equal(t, map[int][]interface{}{0: {uint(0), uint(0), uint(0), uint(0)}, 1: nil}, result.Responses())
+	assert.Equal(t, map[int][]interface{}{0: nil, 1: {uint(0), uint(0)}}, result.Traces())
+	assert.Len(t, result.Processes[0].Faults, 1)
+	assert.Len(t, result.Processes[1].Faults, 2)
+	assert.Equal(t, Fault{Kind: FaultDuplicate, From: 1, To: 0, Payload: "pong"}, result.Processes[1].Faults[0].Payload)
+}
+
+func TestFaultsCorrupt(t *testing.T) {
+	z := newTestZmey(&Config{Deterministic: true}, 2, newPingProcess, 1)
+	z.Faults(func(from, to int, payload interface{}, r *rand.Rand) Fate {
+		if payload == "pong" {
+			return Fate{Corrupt: true, Payload: "gnop"}
+		}
+		return Fate{}
+	})
+
+	result, err := z.Run(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, map[int][]interface{}{0: nil, 1: nil}, result.Responses())
+	assert.Equal(t, map[int][]interface{}{0: nil, 1: {uint(0)}}, result.Traces())
+	require.Len(t, result.Processes[1].Faults, 1)
+	fault := result.Processes[1].Faults[0].Payload.(Fault)
+	assert.Equal(t, Fault{Kind: FaultCorrupt, From: 1, To: 0, Payload: "pong", Corrupted: "gnop"}, fault)
+	assert.Equal(t, "corrupt 1 -> 0: pong => gnop", fault.String())
+}
+
+func TestFaultsConcurrent(t *testing.T) {
+	z := newTestZmey(&Config{}, 2, newPingProcess, 1)
+	z.Faults(RandomFaults(FaultRates{Drop: 1}))
+	assert.Nil(t, z.faultF)
+
+	responses, _, err := z.Round(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[int][]interface{}{0: {uint(0)}, 1: nil}, responses)
+}
+
+func TestRandomFaults(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	faultF := RandomFaults(FaultRates{Drop: 0.2, Duplicate: 0.1})
+
+	dropped, duplicated := 0, 0
+	for i := 0; i < 10000; i++ {
+		fate := faultF(0, 1, i, r)
+		if fate.Drop {
+			dropped++
+		}
+		duplicated += fate.Duplicates
+	}
+
+	assert.InDelta(t, 2000, dropped, 200)
+	assert.InDelta(t, 800, duplicated, 100)
+}
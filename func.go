@@ -4,259 +4,296 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"reflect"
 	"runtime/debug"
 	"sync"
 	"time"
 )
 
-func (z *Zmey) processLoop(ctx context.Context, wg *sync.WaitGroup, pack *pack, session *Session, net *Net) {
-	wg.Add(1)
-	defer wg.Done()
+// driver runs a concurrent Round. Instead of a goroutine per process, a pool
+// of workers executes the events: a process is queued in `readyC` whenever it
+// has membership events, calls, ticks or messages pending, and is run by a
+// single worker at a time, one event after the other. The cost of an event
+// does not depend on the number of processes.
+type driver struct {
+	z       *Zmey
+	net     *Net
+	session *Session
+	// readyC holds each process at most once, so that it never blocks
+	readyC chan *pack
+}
 
-	session.ProfProcessStart(pack.pid)
+func newDriver(z *Zmey, session *Session) *driver {
+	d := driver{
+		z:       z,
+		session: session,
+		readyC:  make(chan *pack, len(z.packs)),
+	}
 
-	scale := len(z.packs)
+	return &d
+}
 
-	if !pack.isStarted {
-		func() {
-			defer func() {
-				if r := recover(); r != nil {
-					log.Printf("[%4d] processLoop: panic: %v", pack.pid, r)
-					debug.PrintStack()
-					return
-				}
-			}()
-			pack.process.Init(
-				pack.api.Send,
-				pack.api.Return,
-				pack.api.Trace,
-				pack.api.ReportError,
-			)
-		}()
-
-		pack.isStarted = true
-	}
+// wake queues the process, unless it is already queued or running
+func (d *driver) wake(pack *pack) {
+	pack.lock.Lock()
+	defer pack.lock.Unlock()
 
-	cases := make([]reflect.SelectCase, scale+4)
-	for i, pid := range z.pids {
-		recvC, err := net.Recv(pack.pid, pid)
-		if err != nil {
-			log.Printf("[%4d] processLoop: error: %s", pack.pid, err)
-			continue
-		}
-		cases[i] = reflect.SelectCase{
-			Dir:  reflect.SelectRecv,
-			Chan: reflect.ValueOf(recvC),
-		}
-	}
-	cases[scale] = reflect.SelectCase{
-		Dir:  reflect.SelectRecv,
-		Chan: reflect.ValueOf(pack.callC),
+	if !pack.scheduled {
+		pack.scheduled = true
+		d.readyC <- pack
 	}
+}
 
-	cases[scale+1] = reflect.SelectCase{
-		Dir:  reflect.SelectRecv,
-		Chan: reflect.ValueOf(pack.tickC),
+// wakePid queues the process `pid`, see wake
+func (d *driver) wakePid(pid int) {
+	if pack, ok := d.z.packs[pid]; ok {
+		d.wake(pack)
 	}
+}
 
-	cases[scale+3] = reflect.SelectCase{
-		Dir:  reflect.SelectRecv,
-		Chan: reflect.ValueOf(ctx.Done()),
-	}
-	for {
+func (d *driver) call(pid int, payload interface{}) {
+	d.session.begin(flightCall)
 
-		cases[scale+2] = reflect.SelectCase{
-			Dir:  reflect.SelectRecv,
-			Chan: reflect.ValueOf(time.After(timeoutProcess)),
-		}
+	pack := d.z.packs[pid]
 
-		session.ProfProcessSelectStart(pack.pid)
-		chosen, value, ok := reflect.Select(cases)
-		session.ProfProcessSelectEnd(pack.pid)
+	pack.lock.Lock()
+	pack.calls = append(pack.calls, payload)
+	pack.lock.Unlock()
 
-		if chosen != scale+3 && !ok {
-			log.Printf("[%4d] processLoop: channel %d is closed", pack.pid, chosen)
-			continue
-		}
+	d.wake(pack)
+}
 
-		switch {
-		case 0 <= chosen && chosen < scale: // network recv
-			payload := value.Interface()
+func (d *driver) tick(pack *pack, t uint) {
+	d.session.begin(flightTick)
 
-			if z.c.Debug {
-				log.Printf("[%4d] processLoop: received message from %d : %+v", pack.pid, chosen, payload)
-			}
-			func() {
-				defer func() {
-					if r := recover(); r != nil {
-						log.Printf("[%4d] processLoop: panic: %v", pack.pid, r)
-						debug.PrintStack()
-						return
-					}
-				}()
-				pack.process.ReceiveNet(z.pids[chosen], payload)
-			}()
-			if z.c.Debug {
-				log.Printf("[%4d] processLoop: message processed", pack.pid)
-			}
-		case chosen == scale: // client recv
-			call := value.Interface()
+	pack.lock.Lock()
+	pack.ticks = append(pack.ticks, t)
+	pack.lock.Unlock()
 
-			if z.c.Debug {
-				log.Printf("[%4d] processLoop: received call: %+v", pack.pid, call)
-			}
-			func() {
-				defer func() {
-					if r := recover(); r != nil {
-						log.Printf("[%4d] processLoop: panic: %v", pack.pid, r)
-						debug.PrintStack()
-						return
-					}
-				}()
-				pack.process.ReceiveCall(call)
-			}()
+	d.wake(pack)
+}
 
-			if z.c.Debug {
-				log.Printf("[%4d] processLoop: call processed", pack.pid)
-			}
-		case chosen == scale+1: // tick
-			t, ok := value.Interface().(uint)
-			if !ok {
-				log.Printf("[%4d] processLoop: value cannot be converted to tick: %+v", pack.pid, value)
-				continue
-			}
+// worker runs the queued processes until the context is cancelled. The
+// caller should add the worker to `wg`.
+func (d *driver) worker(ctx context.Context, wg *sync.WaitGroup, id int) {
+	defer wg.Done()
 
-			if z.c.Debug {
-				log.Printf("[%4d] processLoop: received tick: %d", pack.pid, t)
-			}
-			func() {
-				defer func() {
-					if r := recover(); r != nil {
-						log.Printf("[%4d] processLoop: panic: %v", pack.pid, r)
-						debug.PrintStack()
-						return
-					}
-				}()
-				pack.process.Tick(t)
-			}()
-
-		case chosen == scale+2: // timeout
-			if z.c.Debug {
-				log.Printf("[%4d] processLoop: idle", pack.pid)
-			}
-			session.ReportProcessIdle(pack.pid)
-			time.Sleep(sleepProcess)
-			session.ReportProcessBusy(pack.pid)
-		case chosen == scale+3: // context cancel
-			if z.c.Debug {
-				log.Printf("[%4d] processLoop: cancelled", pack.pid)
+	d.session.ProfProcessStart(id)
+
+	for {
+		d.session.ProfProcessSelectStart(id)
+		select {
+		case pack := <-d.readyC:
+			d.session.ProfProcessSelectEnd(id)
+			// Once aborted, the events left are not processed
+			if !d.z.aborted() {
+				d.run(pack)
 			}
-			session.ReportProcessIdle(pack.pid)
+		case <-ctx.Done():
+			d.session.ProfProcessSelectEnd(id)
+			d.session.ReportProcessIdle(id)
 			return
-		default:
-			log.Printf("[%4d] processLoop: chosen incorrect channel %d", pack.pid, chosen)
 		}
-
 	}
-
 }
 
-func (z *Zmey) collectLoop(ctx context.Context, wg *sync.WaitGroup, session *Session) {
-	wg.Add(1)
-	defer wg.Done()
-
-	session.ProfCollectStart()
+// run starts the process if need be, or executes its next event. The
+// process is queued again if more events are pending.
+func (d *driver) run(pack *pack) {
+	z := d.z
 
-	scale := len(z.packs)
+	if !pack.isStarted {
+		z.initProcess(pack)
+		d.session.end(flightStart)
+		d.requeue(pack)
+		return
+	}
 
-	cases := make([]reflect.SelectCase, 2*scale+2)
+	kind := StepNet
+	var call interface{}
+	var t uint
+	var membership *MembershipEvent
+
+	pack.lock.Lock()
+	switch {
+	case len(pack.membership) > 0:
+		membership = &pack.membership[0]
+		pack.membership = pack.membership[1:]
+	case len(pack.calls) > 0:
+		kind = StepCall
+		call = pack.calls[0]
+		pack.calls = pack.calls[1:]
+	case len(pack.ticks) > 0:
+		kind = StepTick
+		t = pack.ticks[0]
+		pack.ticks = pack.ticks[1:]
+	}
+	pack.lock.Unlock()
 
-	for i, pid := range z.pids {
-		cases[i] = reflect.SelectCase{
-			Dir:  reflect.SelectRecv,
-			Chan: reflect.ValueOf(z.packs[pid].returnC),
-		}
+	if membership != nil {
+		z.receiveMembership(pack, *membership)
+		d.session.end(flightMembership)
+		d.requeue(pack)
+		return
 	}
 
-	for i, pid := range z.pids {
-		cases[scale+i] = reflect.SelectCase{
-			Dir:  reflect.SelectRecv,
-			Chan: reflect.ValueOf(z.packs[pid].traceC),
+	switch kind {
+	case StepCall:
+		if z.c.Debug {
+			log.Printf("[%4d] run: received call: %+v", pack.pid, call)
+		}
+		z.handle(pack, Event{Kind: EventCall, Payload: call, Clock: z.stamp(pack.pid)}, func() {
+			pack.process.ReceiveCall(call)
+		})
+		d.session.end(flightCall)
+		if z.c.Debug {
+			log.Printf("[%4d] run: call processed", pack.pid)
+		}
+	case StepTick:
+		if z.c.Debug {
+			log.Printf("[%4d] run: received tick: %d", pack.pid, t)
+		}
+		z.handle(pack, Event{Kind: EventTick, Payload: t, Clock: z.stamp(pack.pid)}, func() {
+			pack.process.Tick(t)
+		})
+		d.session.end(flightTick)
+	case StepNet:
+		from, m, ok := d.net.next(pack.pid)
+		if !ok {
+			break
+		}
+		if z.c.Debug {
+			log.Printf("[%4d] run: received message from %d : %+v", pack.pid, from, m.payload)
+		}
+		z.count(pack.pid, 0, 1)
+		e := Event{Kind: EventDeliver, Peer: from, Msg: m.id, Payload: m.payload, Clock: z.receive(pack.pid, m.clock)}
+		z.handle(pack, e, func() {
+			pack.process.ReceiveNet(from, m.payload)
+		})
+		d.session.end(flightMessage)
+		if z.c.Debug {
+			log.Printf("[%4d] run: message processed", pack.pid)
 		}
 	}
 
-	cases[2*scale+1] = reflect.SelectCase{
-		Dir:  reflect.SelectRecv,
-		Chan: reflect.ValueOf(ctx.Done()),
+	d.requeue(pack)
+}
+
+// requeue queues the process again if it has events pending, otherwise
+// lets wake queue it on the next event
+func (d *driver) requeue(pack *pack) {
+	pack.lock.Lock()
+	defer pack.lock.Unlock()
+
+	if len(pack.membership) > 0 || len(pack.calls) > 0 || len(pack.ticks) > 0 || d.net.pending(pack.pid) {
+		d.readyC <- pack
+		return
 	}
+	pack.scheduled = false
+}
 
-	for {
-		cases[2*scale] = reflect.SelectCase{
-			Dir:  reflect.SelectRecv,
-			Chan: reflect.ValueOf(time.After(timeoutCollect)),
+// initProcess calls Init of the process and marks it as started
+func (z *Zmey) initProcess(pack *pack) {
+	z.invoke(pack, func() {
+		if p, ok := pack.process.(StorageProcess); ok {
+			if pack.storage == nil {
+				pack.storage = newStorage()
+			}
+			p.BindStorage(pack.storage)
+		}
+		if p, ok := pack.process.(APIProcess); ok {
+			p.BindAPI(pack.api)
 		}
+		pack.process.Init(
+			pack.api.Send,
+			pack.api.Return,
+			pack.api.Trace,
+			pack.api.ReportError,
+		)
+	})
 
-		session.ProfCollectSelectStart()
-		chosen, value, ok := reflect.Select(cases)
-		session.ProfCollectSelectEnd()
+	pack.isStarted = true
+}
+
+// handle reports the event `e` of the process, calls f to pass it to the
+// process, and reports the end of the handler with EventDone
+func (z *Zmey) handle(pack *pack, e Event, f func()) {
+	e.Pid = pack.pid
+	z.emit(e)
+	z.invoke(pack, f)
+	z.emit(Event{Kind: EventDone, Pid: pack.pid, Payload: e.Kind})
+}
 
-		if chosen != 2*scale+1 && !ok {
-			log.Printf("[   C] channel %d is closed", chosen)
-			continue
+// invoke calls f, recovering from a panic raised by the process
+func (z *Zmey) invoke(pack *pack, f func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[%4d] invoke: panic: %v", pack.pid, r)
+			debug.PrintStack()
+			clock := z.stamp(pack.pid)
+			z.emit(Event{Kind: EventPanic, Pid: pack.pid, Payload: r, Clock: clock})
+			z.collect(pack.pid, entryPanic, r, clock)
+			return
 		}
+	}()
+	f()
+}
 
-		switch {
-		case 0 <= chosen && chosen < scale: // return call
-			call := value.Interface()
-			if z.c.Debug {
-				log.Printf("[   C] appending response for pid %d", chosen)
-			}
-			pack := z.packs[z.pids[chosen]]
-			pack.responses = append(pack.responses, call)
-		case scale <= chosen && chosen < 2*scale: // trace call
-			trace := value.Interface()
-			if z.c.Debug {
-				log.Printf("[   C] appending trace for pid %d", chosen)
-			}
-			pack := z.packs[z.pids[chosen-scale]]
-			pack.traces = append(pack.traces, trace)
-		case chosen == 2*scale: // timeout
-			if z.c.Debug {
-				log.Printf("[   C] idle")
+// collectItem is a return or a trace of the process `pid`, passed to the
+// collect loop
+type collectItem struct {
+	pid     int
+	kind    entryKind
+	payload interface{}
+	clock   VectorClock
+}
+
+// collectLoop gathers the returns and traces of the processes. The caller
+// should add the loop to `wg`.
+func (z *Zmey) collectLoop(ctx context.Context, wg *sync.WaitGroup, session *Session) {
+	defer wg.Done()
+
+	session.ProfCollectStart()
+
+	for {
+		session.ProfCollectSelectStart()
+		select {
+		case item := <-z.collectC:
+			session.ProfCollectSelectEnd()
+
+			z.collect(item.pid, item.kind, item.payload, item.clock)
+			if item.kind == entryResponse {
+				if z.c.Debug {
+					log.Printf("[   C] appending response for pid %d", item.pid)
+				}
+				session.end(flightReturn)
+			} else {
+				if z.c.Debug {
+					log.Printf("[   C] appending trace for pid %d", item.pid)
+				}
+				session.end(flightTrace)
 			}
-			session.ReportCollectIdle()
-			time.Sleep(sleepCollect)
-			session.ReportCollectBusy()
-		case chosen == 2*scale+1: // cancel
+		case <-ctx.Done():
+			session.ProfCollectSelectEnd()
+
 			if z.c.Debug {
 				log.Printf("[   C] cancelled")
 			}
 			session.ReportCollectIdle()
 			return
-		default:
-			log.Printf("[   C] chosen incorrect channel %d", chosen)
 		}
-
 	}
 }
 
-func (z *Zmey) tickF(pack *pack, wg *sync.WaitGroup, t uint) {
-	wg.Add(1)
+// statusLoop reports the status and the buffer stats to whoever listens. The
+// buffer stats of networks larger than maxBufferStats are not reported. The
+// caller should add the loop to `wg`.
+func (z *Zmey) statusLoop(ctx context.Context, wg *sync.WaitGroup, net *Net, session *Session) {
 	defer wg.Done()
 
-	if z.c.Debug {
-		log.Printf("[%4d] tickF: received %d", pack.pid, t)
-	}
-	pack.tickC <- t
-	if z.c.Debug {
-		log.Printf("[%4d] tickF: done", pack.pid)
+	var bufferStatsC chan string
+	if net.scale <= maxBufferStats {
+		bufferStatsC = z.bufferStatsC
 	}
-}
-
-func (z *Zmey) statusLoop(ctx context.Context, wg *sync.WaitGroup, net *Net, session *Session) {
-	wg.Add(1)
-	defer wg.Done()
 
 	for {
 		receivedN, bufferedN, sentN := net.Stats()
@@ -266,13 +303,17 @@ func (z *Zmey) statusLoop(ctx context.Context, wg *sync.WaitGroup, net *Net, ses
 			session.Profs(),
 		)
 
+		var bufferStats string
+		if bufferStatsC != nil {
+			bufferStats = net.BufferStats()
+		}
+
 		select {
 		case z.statusC <- statusStr:
-		case z.bufferStatsC <- net.BufferStats():
+		case bufferStatsC <- bufferStats:
+		case <-time.After(statusPeriod):
 		case <-ctx.Done():
 			return
-		default:
-			time.Sleep(100 * time.Millisecond)
 		}
 	}
 }
@@ -1,5 +1,7 @@
 module github.com/stratumn/zmey
 
+go 1.15
+
 require (
 	github.com/davecgh/go-spew v1.1.1
 	github.com/pmezard/go-difflib v1.0.0
@@ -0,0 +1,84 @@
+package zmey
+
+import (
+	"math"
+	"math/rand"
+)
+
+// LatencyModel tells how long a message takes to go from process `from` to
+// process `to`, in units of virtual time. `r` is the pseudo-random generator
+// of the network, so that the delays are reproducible.
+type LatencyModel interface {
+	Latency(from, to int, r *rand.Rand) uint
+}
+
+// LatencyFunc is a function implementing LatencyModel
+type LatencyFunc func(from, to int, r *rand.Rand) uint
+
+// Latency implements LatencyModel
+func (f LatencyFunc) Latency(from, to int, r *rand.Rand) uint {
+	return f(from, to, r)
+}
+
+// Link is a directed connection between two processes
+type Link struct {
+	From int
+	To   int
+}
+
+// FixedLatency delays every message by `d`
+func FixedLatency(d uint) LatencyModel {
+	return LatencyFunc(func(int, int, *rand.Rand) uint {
+		return d
+	})
+}
+
+// UniformLatency delays messages uniformly between `min` and `max`, both
+// included
+func UniformLatency(min, max uint) LatencyModel {
+	return LatencyFunc(func(from, to int, r *rand.Rand) uint {
+		if max <= min {
+			return min
+		}
+		return min + uint(r.Int63n(int64(max-min)+1))
+	})
+}
+
+// NormalLatency delays messages following the normal distribution, negative
+// delays are rounded up to zero
+func NormalLatency(mean, stddev float64) LatencyModel {
+	return LatencyFunc(func(from, to int, r *rand.Rand) uint {
+		return roundLatency(r.NormFloat64()*stddev + mean)
+	})
+}
+
+// ParetoLatency delays messages following the Pareto distribution, which has
+// a long tail: most of the messages take about `min`, but some of them take
+// much longer. The smaller `alpha` is, the longer the tail.
+func ParetoLatency(min, alpha float64) LatencyModel {
+	return LatencyFunc(func(from, to int, r *rand.Rand) uint {
+		// Inverse transform sampling, 1 - r.Float64() is in (0, 1]
+		return roundLatency(min / math.Pow(1-r.Float64(), 1/alpha))
+	})
+}
+
+// LinkLatency uses the model given for each link, and `fallback` for the
+// links which are not in `links`
+func LinkLatency(fallback LatencyModel, links map[Link]LatencyModel) LatencyModel {
+	return LatencyFunc(func(from, to int, r *rand.Rand) uint {
+		if m, ok := links[Link{From: from, To: to}]; ok {
+			return m.Latency(from, to, r)
+		}
+		return fallback.Latency(from, to, r)
+	})
+}
+
+func roundLatency(d float64) uint {
+	if d < 0 || math.IsNaN(d) {
+		return 0
+	}
+	if d > math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return uint(math.Round(d))
+}
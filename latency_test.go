@@ -0,0 +1,68 @@
+package zmey
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newPingProcess makes a process which pings the process given in the call,
+// and returns the time at which the pong arrives
+func newPingProcess(int) Process {
+	return &apiProcess{
+		callF: func(api API, payload interface{}) {
+			api.Send(payload.(int), "ping")
+		},
+		netF: func(api API, from int, payload interface{}) {
+			switch payload {
+			case "ping":
+				api.Trace(api.Now())
+				api.Send(from, "pong")
+			case "pong":
+				api.Return(api.Now())
+			}
+		},
+	}
+}
+
+func TestLatency(t *testing.T) {
+	z := newTestZmey(&Config{Deterministic: true}, 2, newPingProcess, 1)
+	z.Latency(LinkLatency(FixedLatency(10), map[Link]LatencyModel{
+		{From: 0, To: 1}: FixedLatency(3),
+	}))
+
+	responses, traces, err := z.Round(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, map[int][]interface{}{0: {uint(13)}, 1: nil}, responses)
+	assert.Equal(t, map[int][]interface{}{0: nil, 1: {uint(3)}}, traces)
+	assert.Equal(t, uint(13), z.Now())
+}
+
+func TestLatencyConcurrent(t *testing.T) {
+	z := newTestZmey(&Config{}, 2, newPingProcess, 1)
+	z.Latency(FixedLatency(10))
+	assert.Nil(t, z.latency)
+
+	responses, _, err := z.Round(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[int][]interface{}{0: {uint(0)}, 1: nil}, responses)
+}
+
+func TestLatencyModels(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 1000; i++ {
+		d := UniformLatency(5, 8).Latency(0, 1, r)
+		assert.True(t, 5 <= d && d <= 8, "uniform latency %d", d)
+
+		d = ParetoLatency(4, 1.5).Latency(0, 1, r)
+		assert.True(t, 4 <= d, "pareto latency %d", d)
+	}
+
+	assert.Equal(t, uint(0), NormalLatency(-100, 1).Latency(0, 1, r))
+	assert.Equal(t, uint(7), UniformLatency(7, 7).Latency(0, 1, r))
+}
@@ -0,0 +1,188 @@
+package zmey
+
+import (
+	"fmt"
+	"log"
+	"sort"
+)
+
+// MembershipKind tells whether a process joined or left
+type MembershipKind int
+
+// The kinds of membership events
+const (
+	// MemberJoin is announced when a process is added
+	MemberJoin MembershipKind = iota
+	// MemberLeave is announced when a process is removed
+	MemberLeave
+)
+
+var membershipKindNames = map[MembershipKind]string{
+	MemberJoin:  "join",
+	MemberLeave: "leave",
+}
+
+func (k MembershipKind) String() string {
+	if name, ok := membershipKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("MembershipKind(%d)", int(k))
+}
+
+// MembershipEvent tells a process that the process `Pid` joined or left
+type MembershipEvent struct {
+	Kind MembershipKind
+	Pid  int
+}
+
+func (e MembershipEvent) String() string {
+	return fmt.Sprintf("%s %d", e.Kind, e.Pid)
+}
+
+// JoinAt adds the process `pid` once the virtual time reaches `t`, in the
+// middle of a deterministic Round. The process is started right away, and the
+// others are told with a MemberJoin event. JoinAt requires
+// Config.Deterministic, otherwise it logs an error and schedules nothing.
+// JoinAt is thread-safe.
+func (z *Zmey) JoinAt(t uint, pid int, process Process) {
+	z.Lock()
+	defer z.Unlock()
+
+	if !z.c.Deterministic {
+		log.Printf("[%4d] JoinAt: Error: not in deterministic mode", pid)
+		return
+	}
+
+	z.schedule(t, func() {
+		z.join(pid, process)
+	})
+}
+
+// LeaveAt removes the process `pid` once the virtual time reaches `t`, in the
+// middle of a deterministic Round. The messages buffered for the process are
+// lost, and the others are told with a MemberLeave event. LeaveAt requires
+// Config.Deterministic, otherwise it logs an error and schedules nothing.
+// LeaveAt is thread-safe.
+func (z *Zmey) LeaveAt(t uint, pid int) {
+	z.Lock()
+	defer z.Unlock()
+
+	if !z.c.Deterministic {
+		log.Printf("[%4d] LeaveAt: Error: not in deterministic mode", pid)
+		return
+	}
+
+	z.schedule(t, func() {
+		z.leave(pid)
+	})
+}
+
+// join is applied by the scheduler, see JoinAt
+func (z *Zmey) join(pid int, process Process) {
+	if _, ok := z.packs[pid]; ok {
+		log.Printf("[%4d] Join: Error: process exists", pid)
+		return
+	}
+
+	z.setProcess(pid, process)
+	z.net.setPids(z.pids)
+
+	pack := z.packs[pid]
+	pack.api.BindNet(z.net)
+	pack.api.BindScheduler(z.sched)
+	pack.client.sched = z.sched
+	z.initProcess(pack)
+
+	if z.c.Debug {
+		log.Printf("[%4d] Join: joined at %d", pid, z.now)
+	}
+}
+
+// leave is applied by the scheduler, see LeaveAt
+func (z *Zmey) leave(pid int) {
+	if _, ok := z.packs[pid]; !ok {
+		log.Printf("[%4d] Leave: Error: no such process", pid)
+		return
+	}
+
+	z.net.clear(pid)
+	z.sched.forget(pid)
+	z.setProcess(pid, nil)
+	z.net.setPids(z.pids)
+
+	if z.c.Debug {
+		log.Printf("[%4d] Leave: left at %d", pid, z.now)
+	}
+}
+
+// announce queues the event for the running processes implementing
+// MembershipProcess, except the one which joined or left
+func (z *Zmey) announce(e MembershipEvent) {
+	for _, pid := range z.pids {
+		pack := z.packs[pid]
+		if pid == e.Pid || !pack.isStarted || pack.crashed {
+			continue
+		}
+		if _, ok := pack.process.(MembershipProcess); !ok {
+			continue
+		}
+
+		pack.lock.Lock()
+		pack.membership = append(pack.membership, e)
+		pack.lock.Unlock()
+
+		z.announced = true
+	}
+}
+
+// ungroup takes the process `pid` out of the groups
+func (z *Zmey) ungroup(pid int) {
+	for name, group := range z.groups {
+		i := sort.SearchInts(group, pid)
+		if i == len(group) || group[i] != pid {
+			continue
+		}
+		if len(group) == 1 {
+			delete(z.groups, name)
+			continue
+		}
+		z.groups[name] = append(group[:i:i], group[i+1:]...)
+	}
+}
+
+// notifyMembers delivers the queued membership events, process by process in
+// increasing order of ids. It is used by deterministic Rounds, concurrent
+// ones deliver the events as any other.
+func (z *Zmey) notifyMembers() {
+	if !z.announced {
+		return
+	}
+	z.announced = false
+
+	for _, pid := range z.pids {
+		pack := z.packs[pid]
+		if pack.crashed {
+			pack.membership = nil
+			continue
+		}
+		for len(pack.membership) > 0 {
+			e := pack.membership[0]
+			pack.membership = pack.membership[1:]
+			z.receiveMembership(pack, e)
+		}
+	}
+}
+
+func (z *Zmey) receiveMembership(pack *pack, e MembershipEvent) {
+	p, ok := pack.process.(MembershipProcess)
+	if !ok {
+		return
+	}
+
+	if z.c.Debug {
+		log.Printf("[%4d] received membership event: %s", pack.pid, e)
+	}
+	z.handle(pack, Event{Kind: EventMembership, Payload: e, Clock: z.stamp(pack.pid)}, func() {
+		p.ReceiveMembership(e)
+	})
+}
@@ -0,0 +1,100 @@
+package zmey
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memberProcess returns the membership events it receives
+type memberProcess struct {
+	apiProcess
+}
+
+func (p *memberProcess) ReceiveMembership(e MembershipEvent) {
+	p.api.Return(e)
+}
+
+func TestMembershipEvents(t *testing.T) {
+	for _, deterministic := range []bool{false, true} {
+		z := NewZmey(&Config{Deterministic: deterministic})
+		for pid := 0; pid < 3; pid++ {
+			z.SetProcess(pid, &memberProcess{})
+		}
+		z.SetGroup("replicas", []int{0, 1})
+
+		_, err := z.Run(context.Background())
+		require.NoError(t, err)
+
+		z.SetProcess(3, &memberProcess{})
+		z.SetProcess(0, nil)
+		// Replacing a process does not change the membership
+		z.SetProcess(2, &memberProcess{})
+
+		result, err := z.Run(context.Background())
+		require.NoError(t, err)
+
+		// The new processes learn the membership from API.Pids, the
+		// replacement of 2 receives the events queued for its predecessor
+		assert.Equal(t, map[int][]interface{}{
+			1: {MembershipEvent{Kind: MemberJoin, Pid: 3}, MembershipEvent{Kind: MemberLeave, Pid: 0}},
+			2: {MembershipEvent{Kind: MemberJoin, Pid: 3}, MembershipEvent{Kind: MemberLeave, Pid: 0}},
+			3: nil,
+		}, result.Responses())
+		assert.Equal(t, []int{1}, z.packs[1].api.Group("replicas"))
+	}
+}
+
+func TestJoinLeaveAt(t *testing.T) {
+	z := NewZmey(&Config{Deterministic: true})
+	z.SetProcess(0, &memberProcess{})
+	z.SetProcess(1, &memberProcess{})
+	z.JoinAt(10, 2, &memberProcess{})
+	z.LeaveAt(20, 0)
+	z.Advance(30)
+
+	result, err := z.Run(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, []Entry{
+		{Seq: 1, Time: 10, Payload: MembershipEvent{Kind: MemberJoin, Pid: 2}},
+	}, result.Processes[0].Responses)
+	assert.Equal(t, []Entry{
+		{Seq: 2, Time: 10, Payload: MembershipEvent{Kind: MemberJoin, Pid: 2}},
+		{Seq: 3, Time: 20, Payload: MembershipEvent{Kind: MemberLeave, Pid: 0}},
+	}, result.Processes[1].Responses)
+	assert.Equal(t, []Entry{
+		{Seq: 4, Time: 20, Payload: MembershipEvent{Kind: MemberLeave, Pid: 0}},
+	}, result.Processes[2].Responses)
+
+	assert.Equal(t, []int{1, 2}, z.packs[1].api.Pids())
+	assert.Equal(t, []int{1, 2}, z.net.pids)
+}
+
+func TestJoinLeaveAtConcurrent(t *testing.T) {
+	z := NewZmey(&Config{})
+	z.SetProcess(0, &memberProcess{})
+	z.JoinAt(0, 1, &memberProcess{})
+	z.LeaveAt(0, 0)
+	assert.Empty(t, z.timeline)
+
+	_, err := z.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []int{0}, z.pids)
+}
+
+func TestLeaveAtDropsMessages(t *testing.T) {
+	z := newTestZmey(&Config{Deterministic: true}, 2, newPingProcess, 1)
+	z.Latency(FixedLatency(5))
+	z.LeaveAt(2, 1)
+
+	result, err := z.Run(context.Background())
+	require.NoError(t, err)
+
+	// The ping sent to 1 is lost, and 0 can no longer reach it
+	assert.Nil(t, result.Processes[0].Responses)
+	assert.Equal(t, 0, result.Processes[0].Received)
+	assert.Equal(t, []int{0}, z.pids)
+}
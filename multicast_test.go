@@ -0,0 +1,107 @@
+package zmey
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFanoutProcess makes a process which broadcasts or multicasts the calls,
+// and returns the sender of each message it receives
+func newFanoutProcess(int) Process {
+	return &apiProcess{
+		callF: func(api API, payload interface{}) {
+			switch payload {
+			case "broadcast":
+				api.Broadcast(payload)
+			case "multicast":
+				api.Multicast("replicas", payload)
+			}
+		},
+		netF: func(api API, from int, payload interface{}) {
+			api.Return(from)
+		},
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	for _, deterministic := range []bool{false, true} {
+		z := newTestZmey(&Config{Deterministic: deterministic}, 4, newFanoutProcess, "broadcast")
+
+		result, err := z.Run(context.Background())
+		require.NoError(t, err)
+
+		assert.Equal(t, map[int][]interface{}{
+			0: nil,
+			1: {0},
+			2: {0},
+			3: {0},
+		}, result.Responses())
+		assert.Equal(t, 3, result.Processes[0].Sent)
+		assert.Equal(t, 1, result.Processes[0].Multicasts)
+	}
+}
+
+func TestMulticast(t *testing.T) {
+	for _, deterministic := range []bool{false, true} {
+		z := newTestZmey(&Config{Deterministic: deterministic}, 4, newFanoutProcess, "multicast")
+		z.SetGroup("replicas", []int{2, 0, 1})
+
+		result, err := z.Run(context.Background())
+		require.NoError(t, err)
+
+		// The sender belongs to the group, and receives the message too
+		assert.Equal(t, map[int][]interface{}{
+			0: {0},
+			1: {0},
+			2: {0},
+			3: nil,
+		}, result.Responses())
+		assert.Equal(t, 3, result.Processes[0].Sent)
+		assert.Equal(t, 1, result.Processes[0].Multicasts)
+	}
+}
+
+func TestMembership(t *testing.T) {
+	z := NewZmey(&Config{Deterministic: true})
+	p := newFanoutProcess(7).(*apiProcess)
+	z.SetProcess(7, p)
+	z.SetProcess(3, newFanoutProcess(3))
+	z.SetGroup("replicas", []int{7, 3})
+
+	_, err := z.Run(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, []int{3, 7}, p.api.Pids())
+	assert.Equal(t, []int{3, 7}, p.api.Group("replicas"))
+	assert.Empty(t, p.api.Group("clients"))
+
+	// A group with an unknown process is rejected, so that Multicast does
+	// not fail
+	z.SetGroup("replicas", []int{3, 5})
+	assert.Equal(t, []int{3, 7}, p.api.Group("replicas"))
+
+	z.SetGroup("replicas", nil)
+	assert.Empty(t, p.api.Group("replicas"))
+}
+
+func TestNetMulticast(t *testing.T) {
+	var wg sync.WaitGroup
+	n := NewNet(context.Background(), &wg, []int{0, 1, 2}, NewSession())
+
+	err := n.Multicast(0, []int{1, 5}, struct{}{})
+	assert.Equal(t, ErrIncorrectPid, err)
+
+	// Nothing is sent if any of the recipients is incorrect
+	_, bufferedN, _ := n.Stats()
+	assert.Equal(t, 0, bufferedN)
+
+	err = n.Multicast(0, []int{1, 2}, struct{}{})
+	require.NoError(t, err)
+
+	_, bufferedN, _ = n.Stats()
+	assert.Equal(t, 2, bufferedN)
+}
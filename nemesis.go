@@ -0,0 +1,166 @@
+package zmey
+
+import (
+	"log"
+	"math/rand"
+)
+
+// NemesisFunc returns the filter installed by a step of a Nemesis, `nil`
+// heals the network. `pids` are the sorted ids of the processes, and `r` is
+// the pseudo-random generator of the network, so that random partitions are
+// reproducible.
+type NemesisFunc func(pids []int, r *rand.Rand) FilterFunc
+
+// NemesisStep installs the filter returned by Apply once the virtual time
+// reaches At
+type NemesisStep struct {
+	At    uint
+	Apply NemesisFunc
+}
+
+// Nemesis is a schedule of network partitions, see Zmey.Nemesis
+type Nemesis []NemesisStep
+
+// Nemesis schedules the steps of the nemesis, which cut links as the virtual
+// time goes, in the middle of a deterministic Round if need be. Each step
+// replaces the filter of the previous one, the links cut by the filter set by
+// Zmey.Filter stay cut. Nemesis requires Config.Deterministic. Nemesis is
+// thread-safe.
+func (z *Zmey) Nemesis(nemesis Nemesis) {
+	z.Lock()
+	defer z.Unlock()
+
+	if !z.c.Deterministic {
+		log.Printf("[   N] Nemesis: Error: not in deterministic mode")
+		return
+	}
+
+	for _, step := range nemesis {
+		apply := step.Apply
+		z.schedule(step.At, func() {
+			pids := append([]int(nil), z.pids...)
+			z.nemesisF = apply(pids, z.netRng)
+			if z.c.Debug {
+				log.Printf("[   N] nemesis at %d", z.now)
+			}
+		})
+	}
+}
+
+// open tells if the link from `from` to `to` is cut neither by the filter nor
+// by the nemesis
+func (z *Zmey) open(from, to int) bool {
+	return (z.filterF == nil || z.filterF(from, to)) &&
+		(z.nemesisF == nil || z.nemesisF(from, to))
+}
+
+// Heal restores the links cut by the previous step of the Nemesis
+func Heal(pids []int, r *rand.Rand) FilterFunc {
+	return nil
+}
+
+// Partition splits the processes into groups which cannot communicate with
+// each other. The processes which are not in any group are isolated.
+func Partition(groups ...[]int) NemesisFunc {
+	component := make(map[int]int)
+	for i, group := range groups {
+		for _, pid := range group {
+			component[pid] = i
+		}
+	}
+
+	return func([]int, *rand.Rand) FilterFunc {
+		return func(from, to int) bool {
+			if from == to {
+				return true
+			}
+			a, ok1 := component[from]
+			b, ok2 := component[to]
+			return ok1 && ok2 && a == b
+		}
+	}
+}
+
+// Isolate cuts all the links of the processes `isolated`
+func Isolate(isolated ...int) NemesisFunc {
+	cut := make(map[int]bool)
+	for _, pid := range isolated {
+		cut[pid] = true
+	}
+
+	return func([]int, *rand.Rand) FilterFunc {
+		return func(from, to int) bool {
+			return from == to || !cut[from] && !cut[to]
+		}
+	}
+}
+
+// RandomHalves splits the processes into two random halves, the second one
+// being the larger if their number is odd
+func RandomHalves(pids []int, r *rand.Rand) FilterFunc {
+	shuffled := shufflePids(pids, r)
+	half := len(shuffled) / 2
+
+	return Partition(shuffled[:half], shuffled[half:])(pids, r)
+}
+
+// RandomIsolation isolates a random process
+func RandomIsolation(pids []int, r *rand.Rand) FilterFunc {
+	if len(pids) == 0 {
+		return nil
+	}
+	return Isolate(pids[r.Intn(len(pids))])(pids, r)
+}
+
+// Bridge splits the processes into two random halves, except one process in
+// the middle which communicates with both of them
+func Bridge(pids []int, r *rand.Rand) FilterFunc {
+	shuffled := shufflePids(pids, r)
+	if len(shuffled) < 3 {
+		return nil
+	}
+	half := len(shuffled) / 2
+	bridge := shuffled[half]
+	halves := Partition(shuffled[:half], shuffled[half+1:])(pids, r)
+
+	return func(from, to int) bool {
+		return from == bridge || to == bridge || halves(from, to)
+	}
+}
+
+// MajoritiesRing arranges the processes in a random ring, where each process
+// communicates with its closest neighbours. Every process sees a majority,
+// but no two processes see the same one.
+func MajoritiesRing(pids []int, r *rand.Rand) FilterFunc {
+	shuffled := shufflePids(pids, r)
+	n := len(shuffled)
+	position := make(map[int]int)
+	for i, pid := range shuffled {
+		position[pid] = i
+	}
+	reach := (n/2 + 1) / 2
+
+	return func(from, to int) bool {
+		a, ok1 := position[from]
+		b, ok2 := position[to]
+		if !ok1 || !ok2 {
+			return false
+		}
+		d := a - b
+		if d < 0 {
+			d = -d
+		}
+		if n-d < d {
+			d = n - d
+		}
+		return d <= reach
+	}
+}
+
+func shufflePids(pids []int, r *rand.Rand) []int {
+	shuffled := append([]int(nil), pids...)
+	r.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	return shuffled
+}
@@ -0,0 +1,134 @@
+package zmey
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// beaconProcess sends the time to every process each `period`, and traces
+// the beacons it receives
+type beaconProcess struct {
+	apiProcess
+	period uint
+}
+
+func newBeaconProcess(int) Process {
+	return &beaconProcess{period: 10}
+}
+
+func (p *beaconProcess) BindAPI(a API) {
+	p.apiProcess.BindAPI(a)
+	p.api.SetTimer(p.period, nil)
+}
+
+func (p *beaconProcess) ReceiveTimer(int, interface{}) {
+	for _, pid := range p.api.Pids() {
+		p.api.Send(pid, p.api.Now())
+	}
+	p.api.SetTimer(p.period, nil)
+}
+
+func (p *beaconProcess) ReceiveNet(from int, payload interface{}) {
+	p.api.Trace(fmt.Sprintf("%d at %d", from, payload))
+}
+
+func TestNemesis(t *testing.T) {
+	z := newTestZmey(&Config{Deterministic: true}, 3, newBeaconProcess)
+
+	z.Nemesis(Nemesis{
+		{At: 15, Apply: Isolate(0)},
+		{At: 25, Apply: Heal},
+	})
+
+	z.Advance(30)
+	_, traces, err := z.Round(context.Background())
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []interface{}{
+		"0 at 10", "1 at 10", "2 at 10",
+		"0 at 20",
+		"0 at 30", "1 at 30", "2 at 30",
+	}, traces[0])
+	assert.ElementsMatch(t, []interface{}{
+		"0 at 10", "1 at 10", "2 at 10",
+		"1 at 20", "2 at 20",
+		"0 at 30", "1 at 30", "2 at 30",
+	}, traces[1])
+}
+
+func TestNemesisFilter(t *testing.T) {
+	z := newTestZmey(&Config{Deterministic: true}, 3, newBeaconProcess)
+
+	z.Filter(func(from, to int) bool {
+		return from != 2
+	})
+	z.Nemesis(Nemesis{
+		{At: 15, Apply: Isolate(0)},
+		{At: 25, Apply: Heal},
+	})
+
+	z.Advance(30)
+	_, traces, err := z.Round(context.Background())
+	require.NoError(t, err)
+
+	// The filter still applies once healed
+	assert.ElementsMatch(t, []interface{}{
+		"0 at 10", "1 at 10",
+		"1 at 20",
+		"0 at 30", "1 at 30",
+	}, traces[1])
+}
+
+func links(pids []int, filterF FilterFunc) map[int][]int {
+	visible := make(map[int][]int)
+	for _, from := range pids {
+		for _, to := range pids {
+			if from != to && filterF(from, to) {
+				visible[from] = append(visible[from], to)
+			}
+		}
+	}
+	return visible
+}
+
+func TestCannedNemeses(t *testing.T) {
+	pids := []int{0, 1, 2, 3, 4}
+	r := rand.New(rand.NewSource(1))
+
+	assert.Equal(t, map[int][]int{0: {1}, 1: {0}, 2: {3}, 3: {2}},
+		links(pids, Partition([]int{0, 1}, []int{2, 3})(pids, r)))
+	assert.Equal(t, map[int][]int{0: {2, 4}, 2: {0, 4}, 4: {0, 2}},
+		links(pids, Isolate(1, 3)(pids, r)))
+	assert.Nil(t, Heal(pids, r))
+
+	visible := links(pids, RandomHalves(pids, r))
+	sizes := []int{}
+	for _, pid := range pids {
+		sizes = append(sizes, len(visible[pid]))
+	}
+	assert.ElementsMatch(t, []int{1, 1, 2, 2, 2}, sizes)
+
+	visible = links(pids, Bridge(pids, r))
+	sizes = sizes[:0]
+	for _, pid := range pids {
+		sizes = append(sizes, len(visible[pid]))
+	}
+	assert.ElementsMatch(t, []int{2, 2, 2, 2, 4}, sizes)
+
+	visible = links(pids, MajoritiesRing(pids, r))
+	seen := make(map[string]bool)
+	for _, pid := range pids {
+		assert.Len(t, visible[pid], 2)
+		majority := append(visible[pid], pid)
+		sort.Ints(majority)
+		key := fmt.Sprint(majority)
+		assert.False(t, seen[key])
+		seen[key] = true
+	}
+}
@@ -3,25 +3,95 @@ package zmey
 import (
 	"context"
 	"fmt"
-	"log"
+	"math/rand"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
-	"time"
+	"sync/atomic"
 )
 
 // TODO: add context
 
-// Net abstracts the inter-process connections
+// message is buffered in Net until it's delivered. `at` is the virtual time
+// of the delivery, `seq` is the number of the message on its link, and `id`
+// identifies the message in the events.
+type message struct {
+	payload interface{}
+	at      uint
+	seq     int
+	id      int
+	clock   VectorClock
+}
+
+// Delivery is a message received from the process `From`
+type Delivery struct {
+	From    int
+	Payload interface{}
+}
+
+// link buffers the messages sent by the process `from` to the owner of a
+// mailbox. `pushed` numbers the messages of the link. `recvC` is created by
+// Recv, the mailbox then delivers the messages of the link to it as well.
+type link struct {
+	from   int
+	queue  []message
+	pushed int
+	recvC  chan interface{}
+}
+
+// mailbox holds the inbound links of the process `pid`, each one created on
+// its first message. `sorted` lists the links by sender id. `arrivals` lists
+// the sender of each buffered message in the order of arrival, it's only kept
+// by a Net running its own goroutines, which deliver the messages to `recvC`
+// and to the channels of the links in `readers`.
+type mailbox struct {
+	pid      int
+	buffered int
+	links    map[int]*link
+	sorted   []*link
+	arrivals []int
+	readers  []*link
+	notifyC  chan struct{}
+	recvC    chan Delivery
+}
+
+// Ordering tells in which order a link delivers its messages
+type Ordering int
+
+const (
+	// FIFO delivers the messages in the order they were sent, as TCP does
+	FIFO Ordering = iota
+	// Unordered delivers the messages in any order, as UDP does
+	Unordered
+)
+
+// OrderingFunc returns the ordering of the link from process `from` to
+// process `to`
+type OrderingFunc func(from, to int) Ordering
+
+// Net abstracts the inter-process connections. Each process has a single
+// mailbox, holding a queue per sender, so the cost of a delivery does not
+// depend on the number of processes.
 type Net struct {
 	scale      int
 	pids       []int
 	rpids      map[int]int
 	session    *Session
 	filterF    FilterFunc
-	inputCs    []chan interface{}
-	outputCs   []chan interface{}
-	buffer     [][]interface{}
+	direct     bool
+	latency    LatencyModel
+	faultF     FaultFunc
+	orderingF  OrderingFunc
+	rng        *rand.Rand
+	now        func() uint
+	reportF    func(f Fault, clock VectorClock)
+	wakeF      func(to int)
+	eventF     func(Event)
+	stampF     func(pid int) VectorClock
+	lastMsg    int64
+	boxes      []*mailbox
+	loaded     map[int]bool
 	bufferLock sync.RWMutex
 	bufferedN  int
 	sentN      int
@@ -31,124 +101,180 @@ type Net struct {
 // NewNet creates and returns a new instance of Net. Scale indicates the size
 // of the network, session may be optionally provided to report status and stats.
 func NewNet(ctx context.Context, wg *sync.WaitGroup, pids []int, session *Session) *Net {
+	n := newNet(pids, session)
+
+	if session != nil {
+		session.ProfNetworkStart()
+	}
+
+	for _, box := range n.boxes {
+		box.notifyC = make(chan struct{}, 1)
+		box.recvC = make(chan Delivery)
+		wg.Add(1)
+		go n.loop(ctx, wg, box)
+	}
+
+	return n
+}
+
+// newDrivenNet creates an instance of Net which runs no goroutines. Each time
+// a message is buffered for a process, `wakeF` is called with its id, and
+// the messages are read with next.
+func newDrivenNet(pids []int, session *Session, wakeF func(to int)) *Net {
+	n := newNet(pids, session)
+	n.wakeF = wakeF
+
+	if session != nil {
+		session.ProfNetworkStart()
+	}
+
+	return n
+}
+
+// newDirectNet creates an instance of Net which runs no goroutines. Sent
+// messages are buffered right away, and it's up to the caller to pop them.
+func newDirectNet(pids []int, session *Session) *Net {
+	n := newNet(pids, session)
+	n.direct = true
+
+	return n
+}
+
+func newNet(pids []int, session *Session) *Net {
 
 	scale := len(pids)
 
 	rpids := make(map[int]int)
+	boxes := make([]*mailbox, scale)
 
 	for i, pid := range pids {
 		rpids[pid] = i
+		boxes[i] = &mailbox{pid: pid, links: make(map[int]*link)}
 	}
 
 	n := Net{
-		pids:     pids,
-		rpids:    rpids,
-		scale:    scale,
-		inputCs:  make([]chan interface{}, scale*scale),
-		outputCs: make([]chan interface{}, scale*scale),
-		buffer:   make([][]interface{}, scale*scale),
-		session:  session,
-	}
-
-	for i := range pids {
-		for j := range pids {
-			n.inputCs[i*scale+j] = make(chan interface{})
-			n.outputCs[i*scale+j] = make(chan interface{})
-		}
+		pids:    pids,
+		rpids:   rpids,
+		scale:   scale,
+		boxes:   boxes,
+		loaded:  make(map[int]bool),
+		session: session,
 	}
 
-	go n.loop(ctx, wg)
-
 	return &n
 }
 
-func (n *Net) loop(ctx context.Context, wg *sync.WaitGroup) {
-	wg.Add(1)
-	defer wg.Done()
+// setPids changes the processes of the network, keeping the mailboxes of the
+// remaining ones. It requires a Net created by newDirectNet.
+func (n *Net) setPids(pids []int) {
+	n.bufferLock.Lock()
+	defer n.bufferLock.Unlock()
 
-	if n.session != nil {
-		n.session.ProfNetworkStart()
-	}
+	rpids := make(map[int]int)
+	boxes := make([]*mailbox, len(pids))
 
-	cases := make([]reflect.SelectCase, 2*n.scale*n.scale+2)
-	for i := range n.inputCs {
-		cases[i] = reflect.SelectCase{
-			Dir:  reflect.SelectRecv,
-			Chan: reflect.ValueOf(n.inputCs[i]),
+	for i, pid := range pids {
+		rpids[pid] = i
+		if index, ok := n.rpids[pid]; ok {
+			boxes[i] = n.boxes[index]
+		} else {
+			boxes[i] = &mailbox{pid: pid, links: make(map[int]*link)}
 		}
 	}
 
-	cases[2*n.scale*n.scale+1] = reflect.SelectCase{
-		Dir:  reflect.SelectRecv,
-		Chan: reflect.ValueOf(ctx.Done()),
+	for _, box := range n.boxes {
+		if _, ok := rpids[box.pid]; !ok {
+			n.bufferedN -= box.buffered
+			delete(n.loaded, box.pid)
+		}
 	}
 
+	n.pids = pids
+	n.rpids = rpids
+	n.scale = len(pids)
+	n.boxes = boxes
+}
+
+// loop delivers the messages of the mailbox in the order of their arrival,
+// one at a time. A message stays buffered until the recipient reads it, from
+// the mailbox or from the channel of its link.
+func (n *Net) loop(ctx context.Context, wg *sync.WaitGroup, box *mailbox) {
+	defer wg.Done()
+
 	for {
-		cases[2*n.scale*n.scale] = reflect.SelectCase{
-			Dir:  reflect.SelectRecv,
-			Chan: reflect.ValueOf(time.After(timeoutNetwork)),
-		}
-		for i := range n.outputCs {
-			if len(n.buffer[i]) > 0 {
-				cases[n.scale*n.scale+i] = reflect.SelectCase{
-					Dir:  reflect.SelectSend,
-					Chan: reflect.ValueOf(n.outputCs[i]),
-					Send: reflect.ValueOf(n.buffer[i][0]),
-				}
-			} else {
-				// It's easier to add nil channel and keep the array length fixed
-				cases[n.scale*n.scale+i] = reflect.SelectCase{
-					Dir:  reflect.SelectSend,
-					Chan: reflect.ValueOf(nil),
-					Send: reflect.ValueOf(struct{}{}),
-				}
-			}
+		n.bufferLock.RLock()
+		ok := len(box.arrivals) > 0
+		var d Delivery
+		if ok {
+			from := box.arrivals[0]
+			d = Delivery{From: from, Payload: box.links[from].queue[0].payload}
 		}
-		if n.session != nil {
-			n.session.ProfNetworkSelectStart()
+		var heads []*link
+		for _, l := range box.readers {
+			if len(l.queue) > 0 {
+				heads = append(heads, l)
+			}
 		}
-		chosen, value, ok := reflect.Select(cases)
-		if n.session != nil {
-			n.session.ProfNetworkSelectEnd()
+		n.bufferLock.RUnlock()
+
+		if len(heads) > 0 {
+			if !n.offer(ctx, box, ok, d, heads) {
+				return
+			}
+			continue
 		}
 
-		switch {
-		case 0 <= chosen && chosen < n.scale*n.scale: // send
-			if chosen != 2*n.scale*n.scale+1 && !ok {
-				log.Printf("[   N] channel %d is closed", chosen)
+		if !ok {
+			select {
+			case <-box.notifyC:
 				continue
+			case <-ctx.Done():
+				return
 			}
+		}
 
-			from := n.pids[chosen%n.scale]
-			to := n.pids[chosen/n.scale]
-
-			if n.filterF == nil || n.filterF(from, to) {
-				n.push(chosen, value.Interface())
-			}
-		case n.scale*n.scale <= chosen && chosen < 2*n.scale*n.scale: // receive
-			// No need to use the returned value, it's been already sent
-			// over the channel in Select() statement
-			_ = n.pop(chosen - n.scale*n.scale)
-		case chosen == 2*n.scale*n.scale: // timeout
-			if n.bufferedN == 0 {
-				if n.session != nil {
-					n.session.ReportNetworkIdle()
-				}
-				time.Sleep(sleepNetwork)
-				if n.session != nil {
-					n.session.ReportNetworkBusy()
-				}
-			}
-		case chosen == 2*n.scale*n.scale+1: // cancel
-			if n.session != nil {
-				n.session.ReportNetworkIdle()
-			}
+		select {
+		case box.recvC <- d:
+			n.pop(box)
+		case <-box.notifyC:
+		case <-ctx.Done():
 			return
-		default:
-			log.Printf("[   N] chosen incorrect channel %d", chosen)
 		}
 	}
+}
+
+// offer passes the earliest message to the mailbox, and the first message of
+// each link in `heads` to the channel of the link, until one of them is read
+// or another message arrives. It returns false once the context is done.
+func (n *Net) offer(ctx context.Context, box *mailbox, ok bool, d Delivery, heads []*link) bool {
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(box.notifyC)},
+	}
+	if ok {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectSend, Chan: reflect.ValueOf(box.recvC), Send: reflect.ValueOf(d)})
+	}
+	first := len(cases)
 
+	n.bufferLock.RLock()
+	for _, l := range heads {
+		// The payload is passed as an interface{}, even if it's nil
+		payload := l.queue[0].payload
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectSend, Chan: reflect.ValueOf(l.recvC), Send: reflect.ValueOf(&payload).Elem()})
+	}
+	n.bufferLock.RUnlock()
+
+	chosen, _, _ := reflect.Select(cases)
+	switch {
+	case chosen == 0:
+		return false
+	case chosen >= first:
+		n.popLink(box, heads[chosen-first])
+	case chosen == 2:
+		n.pop(box)
+	}
+
+	return true
 }
 
 // Filter sets FilterFunc to selectively cut communicational channels
@@ -156,69 +282,272 @@ func (n *Net) Filter(filterF FilterFunc) {
 	n.filterF = filterF
 }
 
+// Latency sets the model delaying the messages, `r` is used to draw the
+// delays. Latency requires a Net running in virtual time, i.e. in a
+// deterministic Round.
+func (n *Net) Latency(latency LatencyModel, r *rand.Rand) {
+	n.latency = latency
+	n.rng = r
+}
+
+// Ordering sets the function telling which links are FIFO. If `orderingF` is
+// `nil`, all the links are FIFO. Unordered links require a Net running in a
+// deterministic Round, whose scheduler picks the delivered messages.
+func (n *Net) Ordering(orderingF OrderingFunc) {
+	n.orderingF = orderingF
+}
+
+// ordered tells if the link from `from` to `to` delivers its messages in
+// order
+func (n *Net) ordered(from, to int) bool {
+	if n.orderingF == nil {
+		return true
+	}
+	return n.orderingF(from, to) == FIFO
+}
+
+// ready returns the earliest virtual time at which a message buffered on the
+// link `l` to `to` can be delivered. The queue should not be empty.
+func (n *Net) ready(l *link, to int) uint {
+	at := l.queue[0].at
+	if !n.ordered(l.from, to) {
+		for _, m := range l.queue[1:] {
+			if m.at < at {
+				at = m.at
+			}
+		}
+	}
+	return at
+}
+
+// recipients returns the set of processes which have messages buffered. The
+// set must not be modified.
+func (n *Net) recipients() map[int]bool {
+	return n.loaded
+}
+
+// inbound returns the links to the process `to`, ordered by sender id. The
+// links and their queues must not be modified.
+func (n *Net) inbound(to int) []*link {
+	toIndex, ok := n.rpids[to]
+	if !ok {
+		return nil
+	}
+	return n.boxes[toIndex].sorted
+}
+
+// Faults sets the function injecting faults in the messages, `r` is used to
+// draw them. The injected faults are reported as events. Faults
+// requires a Net running in a deterministic Round.
+func (n *Net) Faults(faultF FaultFunc, r *rand.Rand) {
+	n.faultF = faultF
+	n.rng = r
+}
+
 // Send sens the message `m` to the recepeint with process id `to`. `as` should
 // represent the id of sender process. If either `as` or `to` is out of range,
 // ErrIncorrectPid is returned
 func (n *Net) Send(as, to int, m interface{}) error {
-	asIndex, ok1 := n.rpids[as]
+	_, ok1 := n.rpids[as]
 	toIndex, ok2 := n.rpids[to]
 	if !ok1 || !ok2 {
 		return ErrIncorrectPid
 	}
 
-	n.inputCs[toIndex*n.scale+asIndex] <- m
+	n.send(as, to, n.boxes[toIndex], m)
 
 	return nil
 }
 
+// Multicast sends the message `m` to each of the processes `tos`, as a single
+// fan-out operation: if any id is out of range, ErrIncorrectPid is returned
+// and nothing is sent. Each copy goes through the filter on its own.
+func (n *Net) Multicast(as int, tos []int, m interface{}) error {
+	if _, ok := n.rpids[as]; !ok {
+		return ErrIncorrectPid
+	}
+
+	boxes := make([]*mailbox, len(tos))
+	for i, to := range tos {
+		toIndex, ok := n.rpids[to]
+		if !ok {
+			return ErrIncorrectPid
+		}
+		boxes[i] = n.boxes[toIndex]
+	}
+
+	for i, to := range tos {
+		n.send(as, to, boxes[i], m)
+	}
+
+	return nil
+}
+
+func (n *Net) send(as, to int, box *mailbox, m interface{}) {
+	item := message{payload: m, id: int(atomic.AddInt64(&n.lastMsg, 1))}
+	if n.stampF != nil {
+		item.clock = n.stampF(as)
+	}
+	n.emit(Event{Kind: EventSend, Pid: as, Peer: to, Msg: item.id, Payload: m, Clock: item.clock})
+
+	if n.filterF != nil && !n.filterF(as, to) {
+		n.emit(Event{Kind: EventFilterDrop, Pid: as, Peer: to, Msg: item.id, Payload: m, Clock: item.clock})
+		return
+	}
+
+	if n.direct {
+		n.deliver(as, to, box, item)
+		return
+	}
+
+	// The message is in flight until the recipient processes it. It is
+	// reported before being pushed, so that its delivery comes after.
+	n.session.begin(flightMessage)
+	n.emit(Event{Kind: EventBuffer, Pid: to, Peer: as, Msg: item.id, Payload: m, Clock: item.clock})
+	n.push(box, as, item)
+
+	if n.wakeF != nil {
+		n.wakeF(to)
+		return
+	}
+
+	select {
+	case box.notifyC <- struct{}{}:
+	default:
+	}
+}
+
+// deliver injects the faults in the message and buffers the copies to be
+// delivered, each one with its own latency
+func (n *Net) deliver(as, to int, box *mailbox, item message) {
+	m := item.payload
+	copies := 1
+	if n.faultF != nil {
+		fate := n.faultF(as, to, m, n.rng)
+		if fate.Drop {
+			n.fault(Fault{Kind: FaultDrop, From: as, To: to, Payload: m}, item)
+			return
+		}
+		if fate.Corrupt {
+			n.fault(Fault{Kind: FaultCorrupt, From: as, To: to, Payload: m, Corrupted: fate.Payload}, item)
+			m = fate.Payload
+			item.payload = m
+		}
+		for i := 0; i < fate.Duplicates; i++ {
+			n.fault(Fault{Kind: FaultDuplicate, From: as, To: to, Payload: m}, item)
+		}
+		copies += fate.Duplicates
+	}
+
+	for i := 0; i < copies; i++ {
+		var at uint
+		if n.now != nil {
+			at = n.now()
+		}
+		if n.latency != nil {
+			at += n.latency.Latency(as, to, n.rng)
+		}
+		item.at = at
+		n.emit(Event{Kind: EventBuffer, Pid: to, Peer: as, Msg: item.id, Payload: m, Clock: item.clock})
+		n.push(box, as, item)
+	}
+}
+
+// emit reports the event of a message, if anyone listens
+func (n *Net) emit(e Event) {
+	if n.eventF != nil {
+		n.eventF(e)
+	}
+}
+
+// fault reports the fault injected in the message `item`
+func (n *Net) fault(f Fault, item message) {
+	n.emit(Event{Kind: EventFault, Pid: f.From, Peer: f.To, Msg: item.id, Payload: f, Clock: item.clock})
+	if n.reportF != nil {
+		n.reportF(f, item.clock)
+	}
+}
+
 // Recv returns the channel of messages. Reading from the channel would
 // yield the messages sent by `from` to `as`. If either `as` or `from`
-// is out of range, ErrIncorrectPid is returned.
+// is out of range, ErrIncorrectPid is returned. Recv requires a Net created
+// by NewNet.
 func (n *Net) Recv(as, from int) (chan interface{}, error) {
 	asIndex, ok1 := n.rpids[as]
-	fromIndex, ok2 := n.rpids[from]
+	_, ok2 := n.rpids[from]
 	if !ok1 || !ok2 {
 		return nil, ErrIncorrectPid
 	}
+	box := n.boxes[asIndex]
+
+	n.bufferLock.Lock()
+	l := box.link(from)
+	if l.recvC == nil {
+		l.recvC = make(chan interface{})
+		box.readers = append(box.readers, l)
+	}
+	n.bufferLock.Unlock()
+
+	// The loop of the mailbox starts offering the messages of the link
+	select {
+	case box.notifyC <- struct{}{}:
+	default:
+	}
+
+	return l.recvC, nil
+}
+
+// Mailbox returns the channel of the mailbox of `as`. Reading from the
+// channel would yield the messages sent to `as` by all the processes, in the
+// order of their arrival, each link delivering its messages in order. If
+// `as` is out of range, ErrIncorrectPid is returned. Mailbox requires a Net
+// created by NewNet.
+func (n *Net) Mailbox(as int) (<-chan Delivery, error) {
+	asIndex, ok := n.rpids[as]
+	if !ok {
+		return nil, ErrIncorrectPid
+	}
 
-	return n.outputCs[asIndex*n.scale+fromIndex], nil
+	return n.boxes[asIndex].recvC, nil
 }
 
 // BufferStats returns an ASCII-formatted matrix of the sizes of buffers
 // (not yet delivered messages)
 func (n *Net) BufferStats() string {
-	s := "    |  to|\n"
-	s += "----+----+" + strings.Repeat("----+", n.scale)
-	s += "\n"
-	s += "from|    |"
+	var b strings.Builder
+
+	line := "----+----+" + strings.Repeat("----+", n.scale) + "\n"
+
+	b.WriteString("    |  to|\n")
+	b.WriteString(line)
+	b.WriteString("from|    |")
 	for i := range n.pids {
-		s += fmt.Sprintf("%4d|", n.pids[i])
+		fmt.Fprintf(&b, "%4d|", n.pids[i])
 	}
-	s += "\n"
-	s += "----+----+" + strings.Repeat("----+", n.scale)
-	s += "\n"
+	b.WriteString("\n")
+	b.WriteString(line)
 
 	func() {
 		n.bufferLock.RLock()
 		defer n.bufferLock.RUnlock()
 
 		for i := range n.pids {
-			s += fmt.Sprintf("    |%4d|", n.pids[i])
+			fmt.Fprintf(&b, "    |%4d|", n.pids[i])
 			for j := range n.pids {
-				nm := fmt.Sprintf("%4d|", len(n.buffer[i*n.scale+j]))
-				if nm == "   0|" {
-					nm = "    |"
+				l, ok := n.boxes[i].links[n.pids[j]]
+				if !ok || len(l.queue) == 0 {
+					b.WriteString("    |")
+					continue
 				}
-				s += nm
+				fmt.Fprintf(&b, "%4d|", len(l.queue))
 			}
-			s += "\n"
+			b.WriteString("\n")
 		}
 	}()
 
-	s += "----+----+" + strings.Repeat("----+", n.scale)
-	s += "\n"
+	b.WriteString(line)
 
-	return s
+	return b.String()
 }
 
 // Stats returns statistics of the network since its creation: number of
@@ -230,24 +559,166 @@ func (n *Net) Stats() (int, int, int) {
 	return n.receivedN, n.bufferedN, n.sentN
 }
 
-func (n *Net) push(index int, item interface{}) {
+// next removes the earliest message arrived for `to`, if any, and returns it
+// along with its sender. It requires a Net created by newDrivenNet.
+func (n *Net) next(to int) (int, message, bool) {
+	n.bufferLock.Lock()
+	defer n.bufferLock.Unlock()
+
+	toIndex, ok := n.rpids[to]
+	if !ok {
+		return 0, message{}, false
+	}
+	box := n.boxes[toIndex]
+	if len(box.arrivals) == 0 {
+		return 0, message{}, false
+	}
+
+	from := box.arrivals[0]
+	item := n.shift(box)
+
+	return from, item, true
+}
+
+// pending tells if messages are buffered for `to`
+func (n *Net) pending(to int) bool {
+	n.bufferLock.RLock()
+	defer n.bufferLock.RUnlock()
+
+	return n.loaded[to]
+}
+
+// push buffers the message sent by `from` in the mailbox
+func (n *Net) push(box *mailbox, from int, item message) {
 	n.bufferLock.Lock()
 	defer n.bufferLock.Unlock()
 
 	n.bufferedN++
 	n.receivedN++
+	box.buffered++
+	n.loaded[box.pid] = true
+
+	l := box.link(from)
+	item.seq = l.pushed
+	l.pushed++
+	l.queue = append(l.queue, item)
 
-	n.buffer[index] = append(n.buffer[index], item)
+	if !n.direct {
+		box.arrivals = append(box.arrivals, from)
+	}
+}
+
+// link returns the link from the process `from`, created on first use. The
+// caller should hold bufferLock.
+func (box *mailbox) link(from int) *link {
+	l, ok := box.links[from]
+	if !ok {
+		l = &link{from: from}
+		box.links[from] = l
+		i := sort.Search(len(box.sorted), func(i int) bool {
+			return box.sorted[i].from > from
+		})
+		box.sorted = append(box.sorted, nil)
+		copy(box.sorted[i+1:], box.sorted[i:])
+		box.sorted[i] = l
+	}
+	return l
 }
 
-func (n *Net) pop(index int) interface{} {
+// pop removes the earliest message arrived in the mailbox
+func (n *Net) pop(box *mailbox) message {
 	n.bufferLock.Lock()
 	defer n.bufferLock.Unlock()
 
-	item := n.buffer[index][0]
-	n.buffer[index] = n.buffer[index][1:]
-	n.bufferedN--
-	n.sentN++
+	return n.shift(box)
+}
+
+// shift removes the earliest message arrived in the mailbox. The caller
+// should hold bufferLock.
+func (n *Net) shift(box *mailbox) message {
+	l := box.links[box.arrivals[0]]
+	box.arrivals = box.arrivals[1:]
+
+	item := l.queue[0]
+	l.queue = l.queue[1:]
+	n.unload(box)
+
+	return item
+}
+
+// popLink removes the first message of the link `l` of the mailbox
+func (n *Net) popLink(box *mailbox, l *link) message {
+	n.bufferLock.Lock()
+	defer n.bufferLock.Unlock()
+
+	for i, from := range box.arrivals {
+		if from == l.from {
+			box.arrivals = append(box.arrivals[:i:i], box.arrivals[i+1:]...)
+			break
+		}
+	}
+
+	item := l.queue[0]
+	l.queue = l.queue[1:]
+	n.unload(box)
 
 	return item
 }
+
+// take removes the message number `seq` sent by `from` to `to`
+func (n *Net) take(to, from int, seq int) message {
+	n.bufferLock.Lock()
+	defer n.bufferLock.Unlock()
+
+	toIndex, ok := n.rpids[to]
+	if !ok {
+		return message{}
+	}
+	box := n.boxes[toIndex]
+	l, ok := box.links[from]
+	if !ok {
+		return message{}
+	}
+
+	queue := l.queue
+	for i := range queue {
+		if queue[i].seq == seq {
+			item := queue[i]
+			l.queue = append(queue[:i:i], queue[i+1:]...)
+			n.unload(box)
+			return item
+		}
+	}
+
+	return message{}
+}
+
+// clear drops the messages buffered for the process `to`
+func (n *Net) clear(to int) {
+	n.bufferLock.Lock()
+	defer n.bufferLock.Unlock()
+
+	toIndex, ok := n.rpids[to]
+	if !ok {
+		return
+	}
+	box := n.boxes[toIndex]
+	for _, l := range box.sorted {
+		n.bufferedN -= len(l.queue)
+		l.queue = nil
+	}
+	box.arrivals = nil
+	box.buffered = 0
+	delete(n.loaded, box.pid)
+}
+
+// unload accounts for a message delivered from the mailbox. The caller should
+// hold bufferLock.
+func (n *Net) unload(box *mailbox) {
+	n.bufferedN--
+	n.sentN++
+	box.buffered--
+	if box.buffered == 0 {
+		delete(n.loaded, box.pid)
+	}
+}
@@ -2,6 +2,7 @@ package zmey
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"testing"
 	"time"
@@ -194,3 +195,118 @@ from|    |  -5|  27|   8|   0|
 		t.Fatalf("expected: \n%s\n actual: \n%s\n", expected, actual)
 	}
 }
+
+func TestMailbox(t *testing.T) {
+	ctx, cancelF := context.WithCancel(context.Background())
+	defer cancelF()
+
+	var wg sync.WaitGroup
+	n := NewNet(ctx, &wg, []int{0, 1, 2, 3}, NewSession())
+	n.Filter(func(from, to int) bool {
+		return from != 3
+	})
+
+	for i := 0; i < 10; i++ {
+		for from := 1; from <= 3; from++ {
+			require.NoError(t, n.Send(from, 0, i))
+		}
+	}
+
+	recvC, err := n.Mailbox(0)
+	require.NoError(t, err)
+
+	recv := map[int][]int{}
+	for i := 0; i < 20; i++ {
+		select {
+		case d := <-recvC:
+			recv[d.From] = append(recv[d.From], d.Payload.(int))
+		case <-time.After(1 * time.Second):
+			t.Fatalf("timeout")
+		}
+	}
+
+	expected := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	assert.Equal(t, map[int][]int{1: expected, 2: expected}, recv)
+
+	// Messages are counted as sent once the loop is done with them
+	cancelF()
+	wg.Wait()
+
+	received, buffered, sent := n.Stats()
+	assert.Equal(t, 20, received)
+	assert.Equal(t, 0, buffered)
+	assert.Equal(t, 20, sent)
+}
+
+func TestRecvLinks(t *testing.T) {
+	ctx, cancelF := context.WithCancel(context.Background())
+	defer cancelF()
+
+	var wg sync.WaitGroup
+	n := NewNet(ctx, &wg, []int{0, 1, 2}, NewSession())
+
+	require.NoError(t, n.Send(1, 0, "a"))
+	require.NoError(t, n.Send(2, 0, "b"))
+	require.NoError(t, n.Send(1, 0, "c"))
+
+	// The messages of a link are not held back by the earlier ones of
+	// another link
+	recvC, err := n.Recv(0, 2)
+	require.NoError(t, err)
+	select {
+	case recv := <-recvC:
+		assert.Equal(t, "b", recv)
+	case <-time.After(1 * time.Second):
+		t.Fatalf("timeout")
+	}
+
+	// The mailbox still yields the remaining messages in order
+	mailboxC, err := n.Mailbox(0)
+	require.NoError(t, err)
+	for _, expected := range []string{"a", "c"} {
+		select {
+		case d := <-mailboxC:
+			assert.Equal(t, Delivery{From: 1, Payload: expected}, d)
+		case <-time.After(1 * time.Second):
+			t.Fatalf("timeout")
+		}
+	}
+
+	cancelF()
+	wg.Wait()
+
+	received, buffered, sent := n.Stats()
+	assert.Equal(t, 3, received)
+	assert.Equal(t, 0, buffered)
+	assert.Equal(t, 3, sent)
+}
+
+// BenchmarkNet sends messages from every process to the next one, and
+// receives them
+func BenchmarkNet(b *testing.B) {
+	for _, scale := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprintf("pids=%d", scale), func(b *testing.B) {
+			ctx, cancelF := context.WithCancel(context.Background())
+			defer cancelF()
+
+			pids := make([]int, scale)
+			for i := range pids {
+				pids[i] = i
+			}
+
+			var wg sync.WaitGroup
+			n := NewNet(ctx, &wg, pids, nil)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				from := i % scale
+				to := (from + 1) % scale
+				if err := n.Send(from, to, i); err != nil {
+					b.Fatal(err)
+				}
+				recvC, _ := n.Mailbox(to)
+				<-recvC
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package zmey
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runCollector(t *testing.T, seed int64, orderingF OrderingFunc) []interface{} {
+	z := NewZmey(&Config{Deterministic: true, Seed: seed})
+	z.SetProcess(0, newCollectorProcess(0))
+	z.SetProcess(1, newCollectorProcess(1))
+
+	z.Ordering(orderingF)
+	z.Inject(func(pid int, c Client) {
+		if pid == 1 {
+			for k := 0; k < 4; k++ {
+				c.Call(k)
+			}
+		}
+	})
+
+	responses, _, err := z.Round(context.Background())
+	require.NoError(t, err)
+
+	return responses[0]
+}
+
+func TestOrderingFIFO(t *testing.T) {
+	for seed := int64(0); seed < 20; seed++ {
+		assert.Equal(t, []interface{}{0, 1, 2, 3}, runCollector(t, seed, nil))
+	}
+}
+
+func TestOrderingUnordered(t *testing.T) {
+	unordered := func(from, to int) Ordering {
+		return Unordered
+	}
+
+	reordered := false
+	for seed := int64(0); seed < 20; seed++ {
+		received := runCollector(t, seed, unordered)
+		assert.ElementsMatch(t, []interface{}{0, 1, 2, 3}, received)
+		if !assert.ObjectsAreEqual([]interface{}{0, 1, 2, 3}, received) {
+			reordered = true
+		}
+	}
+	assert.True(t, reordered)
+
+	assert.Equal(t, runCollector(t, 7, unordered), runCollector(t, 7, unordered))
+}
+
+func TestOrderingConcurrent(t *testing.T) {
+	z := NewZmey(&Config{})
+	z.Ordering(func(from, to int) Ordering {
+		return Unordered
+	})
+	assert.Nil(t, z.orderingF)
+}
@@ -0,0 +1,149 @@
+package zmey
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+)
+
+// ErrReplayDiverged is returned by Round if the processes no longer follow
+// the schedule recorded in Config.Replay.
+var ErrReplayDiverged = errors.New("replay diverged from the recorded schedule")
+
+// Replay holds the seed and the scheduling decisions of deterministic Rounds
+type Replay struct {
+	Seed   int64      `json:"seed"`
+	Rounds []Schedule `json:"rounds"`
+}
+
+// Schedule is the sequence of scheduling decisions of a single Round
+type Schedule struct {
+	// Steps lists the delivered events, in order
+	Steps []Step `json:"steps"`
+	// Drops lists the events that are discarded instead of being delivered
+	Drops []Step `json:"drops,omitempty"`
+	// Partial tells that the Round was stopped before all the events were
+	// delivered. The replay stops there too.
+	Partial bool `json:"partial,omitempty"`
+}
+
+// LoadReplay reads a replay file, as written by Replay.Save
+func LoadReplay(path string) (*Replay, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var r Replay
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// Save writes the replay to a file
+func (r *Replay) Save(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// Seed returns the seed of the pseudo-random scheduler
+func (z *Zmey) Seed() int64 {
+	return z.replay.Seed
+}
+
+// Replay returns the schedule recorded so far by the deterministic Rounds.
+// The returned value can be saved and passed to Config.Replay to run the
+// exact same schedule again. Replay is thread-safe.
+func (z *Zmey) Replay() *Replay {
+	z.Lock()
+	defer z.Unlock()
+
+	r := Replay{
+		Seed:   z.replay.Seed,
+		Rounds: make([]Schedule, len(z.replay.Rounds)),
+	}
+	for i, schedule := range z.replay.Rounds {
+		r.Rounds[i] = Schedule{
+			Steps:   copySteps(schedule.Steps),
+			Drops:   copySteps(schedule.Drops),
+			Partial: schedule.Partial,
+		}
+	}
+
+	return &r
+}
+
+func copySteps(steps []Step) []Step {
+	if steps == nil {
+		return nil
+	}
+	return append([]Step{}, steps...)
+}
+
+// chooser returns the function picking the steps of the current Round, and
+// the events to drop
+func (z *Zmey) chooser() (chooseFunc, []Step) {
+	if z.c.Replay == nil {
+		return func(steps []Step) (int, error) {
+			if len(steps) == 0 {
+				return 0, nil
+			}
+			return z.rng.Intn(len(steps)), nil
+		}, nil
+	}
+
+	round := len(z.replay.Rounds)
+	if round >= len(z.c.Replay.Rounds) {
+		return func([]Step) (int, error) {
+			return 0, fmt.Errorf("%w: round %d was not recorded", ErrReplayDiverged, round)
+		}, nil
+	}
+
+	schedule := z.c.Replay.Rounds[round]
+	var next int
+
+	return func(steps []Step) (int, error) {
+		if next == len(schedule.Steps) {
+			if len(steps) == 0 {
+				return 0, nil
+			}
+			if schedule.Partial {
+				return 0, errStop
+			}
+			return 0, fmt.Errorf("%w: round %d step %d: unexpected %v",
+				ErrReplayDiverged, round, next, steps)
+		}
+
+		for i := range steps {
+			if steps[i] == schedule.Steps[next] {
+				next++
+				return i, nil
+			}
+		}
+
+		return 0, fmt.Errorf("%w: round %d step %d: %s is not in %v",
+			ErrReplayDiverged, round, next, schedule.Steps[next], steps)
+	}, schedule.Drops
+}
+
+// record appends the schedule of a Round to the replay, and saves the replay
+// if Config.Record is set
+func (z *Zmey) record(schedule Schedule) {
+	z.replay.Rounds = append(z.replay.Rounds, schedule)
+
+	if z.c.Record == "" {
+		return
+	}
+
+	if err := z.replay.Save(z.c.Record); err != nil {
+		log.Printf("[   S] record: Error: %s", err)
+	}
+}
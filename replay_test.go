@@ -0,0 +1,68 @@
+package zmey
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRelayZmey(c *Config, scale, hops int) *Zmey {
+	c.Deterministic = true
+	z := NewZmey(c)
+
+	for pid := 0; pid < scale; pid++ {
+		z.SetProcess(pid, newRelayProcess(pid, scale))
+	}
+
+	z.Inject(func(pid int, c Client) {
+		for k := 0; k < hops; k++ {
+			c.Call(relayMessage{ID: pid*hops + k, Hops: k})
+		}
+	})
+
+	return z
+}
+
+func TestReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "replay.json")
+
+	z := newRelayZmey(&Config{Seed: 7, Record: path}, 4, 3)
+	_, expectedTraces, err := z.Round(context.Background())
+	require.NoError(t, err)
+
+	replay, err := LoadReplay(path)
+	require.NoError(t, err)
+	assert.Equal(t, z.Replay(), replay)
+	assert.Equal(t, int64(7), replay.Seed)
+	require.Equal(t, 1, len(replay.Rounds))
+
+	z = newRelayZmey(&Config{Seed: 8, Replay: replay}, 4, 3)
+	assert.Equal(t, int64(7), z.Seed())
+	_, actualTraces, err := z.Round(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, expectedTraces, actualTraces)
+	assert.Equal(t, replay, z.Replay())
+}
+
+func TestReplayDiverged(t *testing.T) {
+	z := newRelayZmey(&Config{Seed: 7}, 4, 3)
+	_, _, err := z.Round(context.Background())
+	require.NoError(t, err)
+
+	replay := z.Replay()
+
+	z = newRelayZmey(&Config{Replay: replay}, 4, 4)
+	_, _, err = z.Round(context.Background())
+	assert.True(t, errors.Is(err, ErrReplayDiverged), "unexpected error %v", err)
+
+	z = newRelayZmey(&Config{Replay: replay}, 4, 3)
+	_, _, err = z.Round(context.Background())
+	require.NoError(t, err)
+	_, _, err = z.Round(context.Background())
+	assert.True(t, errors.Is(err, ErrReplayDiverged), "unexpected error %v", err)
+}
@@ -0,0 +1,212 @@
+package zmey
+
+import (
+	"context"
+)
+
+// Entry is a response, a trace, an error, a panic or a fault of a process. Seq
+// orders the entries of all the processes, and Time is the virtual time at
+// which the entry was produced. Clock is the vector clock of the entry, if
+// Config.VectorClocks is set.
+type Entry struct {
+	Seq     int
+	Time    uint
+	Payload interface{}
+	Clock   VectorClock
+}
+
+// ProcessResult holds what a process produced during a Round
+type ProcessResult struct {
+	Responses []Entry
+	Traces    []Entry
+	// Errors are the errors passed to ReportError
+	Errors []Entry
+	// Panics are the values recovered from the panics of the process
+	Panics []Entry
+	// Faults are the faults injected in the messages sent by the process,
+	// see Zmey.Faults
+	Faults []Entry
+	// Sent and Received count the messages sent by the process and delivered
+	// to it
+	Sent     int
+	Received int
+	// Multicasts counts the calls to Broadcast and Multicast, each copy of
+	// the message counts in Sent
+	Multicasts int
+}
+
+// RoundResult holds the results of all the processes, indexed by process id
+type RoundResult struct {
+	Processes map[int]*ProcessResult
+	// Events are the events of the Round, if Config.Events is set
+	Events []Event
+	// aborted tells that a failure ended the Round before all the events
+	// were processed, see Config.AbortOnError
+	aborted bool
+}
+
+// Responses returns the payloads of the responses of each process
+func (r *RoundResult) Responses() map[int][]interface{} {
+	responses := make(map[int][]interface{})
+	for pid, p := range r.Processes {
+		responses[pid] = payloads(p.Responses)
+	}
+	return responses
+}
+
+// Traces returns the payloads of the traces of each process
+func (r *RoundResult) Traces() map[int][]interface{} {
+	traces := make(map[int][]interface{})
+	for pid, p := range r.Processes {
+		traces[pid] = payloads(p.Traces)
+	}
+	return traces
+}
+
+func payloads(entries []Entry) []interface{} {
+	if entries == nil {
+		return nil
+	}
+	items := make([]interface{}, len(entries))
+	for i := range entries {
+		items[i] = entries[i].Payload
+	}
+	return items
+}
+
+// Run runs the simulation like Round, and returns its detailed result. If
+// processes reported errors or panicked, the result is returned along with a
+// FailedError. Run is thread-safe.
+func (z *Zmey) Run(ctx context.Context) (*RoundResult, error) {
+	z.Lock()
+	defer z.Unlock()
+
+	if err := z.round(ctx); err != nil {
+		return nil, err
+	}
+
+	result := z.collected()
+
+	return result, result.failed()
+}
+
+// entryKind tells in which list of ProcessResult an entry goes
+type entryKind int
+
+const (
+	entryResponse entryKind = iota
+	entryTrace
+	entryError
+	entryPanic
+	entryFault
+)
+
+// collect appends an entry to the result of the process `pid`. collect is
+// thread-safe.
+func (z *Zmey) collect(pid int, kind entryKind, payload interface{}, clock VectorClock) {
+	z.resultLock.Lock()
+	defer z.resultLock.Unlock()
+
+	z.seq++
+	entry := Entry{Seq: z.seq, Time: z.now, Payload: payload, Clock: clock}
+
+	p := z.processResult(pid)
+	switch kind {
+	case entryResponse:
+		p.Responses = append(p.Responses, entry)
+	case entryTrace:
+		p.Traces = append(p.Traces, entry)
+	case entryError:
+		p.Errors = append(p.Errors, entry)
+	case entryPanic:
+		p.Panics = append(p.Panics, entry)
+	case entryFault:
+		p.Faults = append(p.Faults, entry)
+	}
+
+	if kind == entryError || kind == entryPanic {
+		z.failures++
+		if z.c.AbortOnError && z.failures == 1 && z.abortC != nil {
+			close(z.abortC)
+		}
+	}
+}
+
+// aborted tells if the Round should end because of a failure, see
+// Config.AbortOnError. aborted is thread-safe.
+func (z *Zmey) aborted() bool {
+	z.resultLock.Lock()
+	defer z.resultLock.Unlock()
+
+	return z.c.AbortOnError && z.failures > 0
+}
+
+// abort records that a failure ended the Round before all the events were
+// processed. abort is thread-safe.
+func (z *Zmey) abort() {
+	z.resultLock.Lock()
+	defer z.resultLock.Unlock()
+
+	z.result.aborted = true
+}
+
+// count adds to the message counters of the process `pid`. count is
+// thread-safe.
+func (z *Zmey) count(pid int, sent, received int) {
+	z.resultLock.Lock()
+	defer z.resultLock.Unlock()
+
+	p := z.processResult(pid)
+	p.Sent += sent
+	p.Received += received
+}
+
+// countMulticast accounts for a fan-out send of `copies` messages by the
+// process `pid`. countMulticast is thread-safe.
+func (z *Zmey) countMulticast(pid int, copies int) {
+	z.resultLock.Lock()
+	defer z.resultLock.Unlock()
+
+	p := z.processResult(pid)
+	p.Sent += copies
+	p.Multicasts++
+}
+
+func (z *Zmey) processResult(pid int) *ProcessResult {
+	p, ok := z.result.Processes[pid]
+	if !ok {
+		p = &ProcessResult{}
+		z.result.Processes[pid] = p
+	}
+	return p
+}
+
+// collected returns the result gathered during the Round, with an entry for
+// each process, and resets it for the next one
+func (z *Zmey) collected() *RoundResult {
+	z.resultLock.Lock()
+	defer z.resultLock.Unlock()
+
+	for _, pid := range z.pids {
+		z.processResult(pid)
+	}
+
+	result := z.result
+	z.result = newRoundResult()
+	z.failures = 0
+
+	return result
+}
+
+// current returns the result gathered so far. It should only be used while
+// the Round is running on a single goroutine.
+func (z *Zmey) current() *RoundResult {
+	for _, pid := range z.pids {
+		z.processResult(pid)
+	}
+	return z.result
+}
+
+func newRoundResult() *RoundResult {
+	return &RoundResult{Processes: make(map[int]*ProcessResult)}
+}
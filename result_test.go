@@ -0,0 +1,72 @@
+package zmey
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFaultyProcess makes a process which reports an error or panics,
+// depending on the call
+func newFaultyProcess(int) Process {
+	return &apiProcess{
+		callF: func(api API, payload interface{}) {
+			switch payload {
+			case "error":
+				api.ReportError(errors.New("boom"))
+			case "panic":
+				panic("boom")
+			}
+		},
+	}
+}
+
+func TestRun(t *testing.T) {
+	z := newTestZmey(&Config{Deterministic: true}, 2, newPingProcess, 1)
+	z.Latency(FixedLatency(5))
+
+	result, err := z.Run(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, &ProcessResult{
+		Responses: []Entry{{Seq: 2, Time: 10, Payload: uint(10)}},
+		Sent:      1,
+		Received:  1,
+	}, result.Processes[0])
+	assert.Equal(t, &ProcessResult{
+		Traces:   []Entry{{Seq: 1, Time: 5, Payload: uint(5)}},
+		Sent:     1,
+		Received: 1,
+	}, result.Processes[1])
+
+	assert.Equal(t, map[int][]interface{}{0: {uint(10)}, 1: nil}, result.Responses())
+	assert.Equal(t, map[int][]interface{}{0: nil, 1: {uint(5)}}, result.Traces())
+}
+
+func TestRunErrors(t *testing.T) {
+	z := NewZmey(&Config{Deterministic: true})
+	z.SetProcess(0, newFaultyProcess(0))
+	z.Inject(func(pid int, c Client) {
+		c.Call("error")
+		c.Call("panic")
+	})
+
+	result, err := z.Run(context.Background())
+	require.True(t, errors.Is(err, ErrProcessFailed))
+
+	assert.Equal(t, []Entry{{Seq: 1, Payload: errors.New("boom")}}, result.Processes[0].Errors)
+	assert.Equal(t, []Entry{{Seq: 2, Payload: "boom"}}, result.Processes[0].Panics)
+
+	// Entries are not carried over to the next Round, but Seq keeps growing
+	z.Inject(func(pid int, c Client) {
+		c.Call("error")
+	})
+	result, err = z.Run(context.Background())
+	require.True(t, errors.Is(err, ErrProcessFailed))
+
+	assert.Equal(t, []Entry{{Seq: 3, Payload: errors.New("boom")}}, result.Processes[0].Errors)
+	assert.Nil(t, result.Processes[0].Panics)
+}
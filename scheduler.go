@@ -0,0 +1,600 @@
+package zmey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+)
+
+// StepKind tells which kind of event a Step delivers
+type StepKind int
+
+// The kinds of events delivered by the deterministic scheduler
+const (
+	StepNet StepKind = iota
+	StepCall
+	StepTick
+	StepTimer
+)
+
+var stepKindNames = map[StepKind]string{
+	StepNet:   "net",
+	StepCall:  "call",
+	StepTick:  "tick",
+	StepTimer: "timer",
+}
+
+func (k StepKind) String() string {
+	if name, ok := stepKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("StepKind(%d)", int(k))
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (k StepKind) MarshalText() ([]byte, error) {
+	if _, ok := stepKindNames[k]; !ok {
+		return nil, fmt.Errorf("unknown step kind %d", int(k))
+	}
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (k *StepKind) UnmarshalText(text []byte) error {
+	for kind, name := range stepKindNames {
+		if name == string(text) {
+			*k = kind
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown step kind %q", text)
+}
+
+// Step is a single scheduling decision: a delivery of a message sent by
+// `From` to `Pid`, or a delivery of a call, a tick or a timer to `Pid`. Seq
+// numbers the messages of a link (or the calls of a process within a Round),
+// which identifies the exact event being delivered. For timers, Seq is the id
+// of the timer.
+type Step struct {
+	Kind StepKind `json:"kind"`
+	Pid  int      `json:"pid"`
+	From int      `json:"from,omitempty"`
+	Seq  int      `json:"seq,omitempty"`
+}
+
+func (st Step) String() string {
+	switch st.Kind {
+	case StepNet:
+		return fmt.Sprintf("net %d -> %d #%d", st.From, st.Pid, st.Seq)
+	case StepCall, StepTimer:
+		return fmt.Sprintf("%s %d #%d", st.Kind, st.Pid, st.Seq)
+	default:
+		return fmt.Sprintf("%s %d", st.Kind, st.Pid)
+	}
+}
+
+// chooseFunc picks the next step to execute among the enabled ones. Once no
+// step is left, it's called with an empty slice and may report an error.
+type chooseFunc func(steps []Step) (int, error)
+
+// timer is armed by a process with API.SetTimer
+type timer struct {
+	id int
+	// local is the time of the process at which the timer fires, deadline
+	// is the corresponding virtual time
+	local    uint
+	deadline uint
+	payload  interface{}
+}
+
+// scheduler runs a Round on a single goroutine. At each iteration it picks
+// one of the pending events using chooseFunc (by default, the pseudo-random
+// generator of Zmey), and executes it synchronously. When no event is
+// pending, the virtual time jumps to the next timer or action of the timeline,
+// up to `limit`. Only the processes with pending events are visited, so the
+// cost of an iteration does not depend on the number of processes.
+type scheduler struct {
+	z      *Zmey
+	net    *Net
+	choose chooseFunc
+	limit  uint
+	calls  map[int][]interface{}
+	ticks  map[int]uint
+	// active lists the processes which may have calls, ticks or timers
+	// pending; the ones with messages are listed by Net
+	active map[int]bool
+	// seqs counts the calls delivered so far, it's indexed by steps with
+	// zero Seq
+	seqs    map[Step]int
+	steps   []Step
+	stopped bool
+	// drops are the events to discard, dropped are the discarded ones
+	drops   map[Step]bool
+	dropped []Step
+}
+
+func newScheduler(z *Zmey, net *Net, choose chooseFunc) *scheduler {
+	s := scheduler{
+		z:      z,
+		net:    net,
+		choose: choose,
+		calls:  make(map[int][]interface{}),
+		ticks:  make(map[int]uint),
+		active: make(map[int]bool),
+		seqs:   make(map[Step]int),
+		drops:  make(map[Step]bool),
+	}
+
+	return &s
+}
+
+// errStop is returned by chooseFunc to end the Round before all the events
+// are delivered
+var errStop = errors.New("stop")
+
+// roundDeterministic is the single-threaded counterpart of Round
+func (z *Zmey) roundDeterministic(ctx context.Context, choose chooseFunc, drops []Step) error {
+	// Messages buffered for crashed processes are kept from one Round to the
+	// next, unless the processes change
+	net := z.net
+	if net == nil || !equalPids(net.pids, z.pids) {
+		net = newDirectNet(z.pids, nil)
+		z.net = net
+	}
+	// The filter may be replaced during the Round by a Nemesis
+	net.Filter(z.open)
+	// The options are set on every Round, so that setting them to nil resets
+	// the Net reused from the previous one
+	net.Latency(z.latency, z.netRng)
+	net.Faults(z.faultF, z.netRng)
+	net.Ordering(z.orderingF)
+	net.now = func() uint {
+		return z.now
+	}
+	net.eventF = z.emit
+	if z.c.VectorClocks {
+		net.stampF = z.stamp
+	}
+	net.lastMsg = z.lastMsg
+	defer func() {
+		z.lastMsg = net.lastMsg
+	}()
+
+	s := newScheduler(z, net, choose)
+	net.reportF = s.collectFault
+	z.sched = s
+	for _, st := range drops {
+		s.drops[st] = true
+	}
+
+	for _, pid := range z.pids {
+		pack := z.packs[pid]
+		pack.api.BindNet(net)
+		pack.api.BindScheduler(s)
+		pack.client.sched = s
+	}
+	defer func() {
+		for _, pack := range z.packs {
+			pack.api.BindScheduler(nil)
+			pack.client.sched = nil
+		}
+		z.sched = nil
+	}()
+
+	for _, pid := range z.pids {
+		if len(z.packs[pid].timers) > 0 {
+			s.active[pid] = true
+		}
+		if !z.packs[pid].isStarted {
+			z.initProcess(z.packs[pid])
+		}
+	}
+
+	z.notifyMembers()
+
+	if z.injectF != nil {
+		for _, pid := range z.pids {
+			z.injectF(pid, z.packs[pid].client)
+		}
+		z.injectF = nil
+	}
+
+	if z.tick != 0 {
+		for _, pid := range z.pids {
+			s.ticks[pid] = z.tick
+			s.active[pid] = true
+		}
+		z.tick = 0
+	}
+
+	s.limit = z.now + z.advance
+	z.advance = 0
+
+	err := s.run(ctx)
+	if err == nil && !s.stopped {
+		z.now = s.limit
+	}
+	z.record(Schedule{
+		Steps:   s.steps,
+		Drops:   s.dropped,
+		Partial: s.stopped,
+	})
+
+	return err
+}
+
+// run executes the pending events until none is left
+func (s *scheduler) run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ErrCancelled
+		default:
+		}
+
+		s.applyActions()
+		s.z.notifyMembers()
+
+		steps := s.enabled()
+		if s.z.aborted() {
+			// The failure may have been the last event, which ends nothing
+			if len(steps) > 0 || s.advance() {
+				s.stopped = true
+				s.z.abort()
+			}
+			return nil
+		}
+		if len(steps) == 0 && s.advance() {
+			continue
+		}
+
+		i, err := s.choose(steps)
+		if err == errStop {
+			s.stopped = true
+			return nil
+		}
+		if err != nil || len(steps) == 0 {
+			return err
+		}
+
+		s.execute(steps[i])
+	}
+}
+
+// enabled lists the events which can be executed next. The order of the list
+// only depends on the state of the simulation.
+// Events listed in drops are discarded on the way.
+func (s *scheduler) enabled() []Step {
+	steps := []Step{}
+
+	for _, pid := range s.pending() {
+		if s.z.packs[pid].crashed {
+			s.lose(pid)
+			continue
+		}
+		for len(s.calls[pid]) > 0 {
+			st := s.numbered(Step{Kind: StepCall, Pid: pid})
+			if !s.drops[st] {
+				steps = append(steps, st)
+				break
+			}
+			s.discard(st)
+		}
+		if _, ok := s.ticks[pid]; ok {
+			st := Step{Kind: StepTick, Pid: pid}
+			if !s.drops[st] {
+				steps = append(steps, st)
+			} else {
+				s.discard(st)
+			}
+		}
+		for _, l := range s.net.inbound(pid) {
+			if s.net.ordered(l.from, pid) {
+				for len(l.queue) > 0 && l.queue[0].at <= s.z.now {
+					st := Step{Kind: StepNet, Pid: pid, From: l.from, Seq: l.queue[0].seq}
+					if !s.drops[st] {
+						steps = append(steps, st)
+						break
+					}
+					s.discard(st)
+				}
+				continue
+			}
+			discarded := []Step{}
+			for _, m := range l.queue {
+				if m.at > s.z.now {
+					continue
+				}
+				st := Step{Kind: StepNet, Pid: pid, From: l.from, Seq: m.seq}
+				if !s.drops[st] {
+					steps = append(steps, st)
+				} else {
+					discarded = append(discarded, st)
+				}
+			}
+			for _, st := range discarded {
+				s.discard(st)
+			}
+		}
+		discarded := []Step{}
+		for _, t := range s.z.packs[pid].timers {
+			if t.deadline > s.z.now {
+				continue
+			}
+			st := Step{Kind: StepTimer, Pid: pid, Seq: t.id}
+			if !s.drops[st] {
+				steps = append(steps, st)
+			} else {
+				discarded = append(discarded, st)
+			}
+		}
+		for _, st := range discarded {
+			s.discard(st)
+		}
+	}
+
+	return steps
+}
+
+// lose drops the calls and ticks sent to the crashed process `pid`, and its
+// inbound messages if need be
+func (s *scheduler) lose(pid int) {
+	for len(s.calls[pid]) > 0 {
+		payload := s.take(s.numbered(Step{Kind: StepCall, Pid: pid})).payload
+		if s.z.c.Debug {
+			log.Printf("[%4d] crashed, call lost: %+v", pid, payload)
+		}
+	}
+	delete(s.ticks, pid)
+	if s.z.packs[pid].dropInbound {
+		s.net.clear(pid)
+	}
+}
+
+// applyActions applies the actions of the timeline which are due
+func (s *scheduler) applyActions() {
+	for len(s.z.timeline) > 0 && s.z.timeline[0].at <= s.z.now {
+		a := s.z.timeline[0]
+		s.z.timeline = s.z.timeline[1:]
+		a.apply()
+	}
+}
+
+// advance moves the virtual time to the next timer, message or action, unless
+// it is beyond the limit. Messages in flight are always delivered within the
+// Round, so the limit is pushed forward if need be. It returns false if the
+// time cannot be advanced.
+func (s *scheduler) advance() bool {
+	found := false
+	var ready uint
+
+	pids := s.pending()
+
+	for _, pid := range pids {
+		if s.z.packs[pid].crashed {
+			continue
+		}
+		for _, l := range s.net.inbound(pid) {
+			if len(l.queue) == 0 {
+				continue
+			}
+			if at := s.net.ready(l, pid); !found || at < ready {
+				ready = at
+				found = true
+			}
+		}
+	}
+
+	if found && ready > s.limit {
+		s.limit = ready
+	}
+	next := s.limit
+
+	if len(s.z.timeline) > 0 && s.z.timeline[0].at <= next {
+		next = s.z.timeline[0].at
+		found = true
+	}
+
+	for _, pid := range pids {
+		for _, t := range s.z.packs[pid].timers {
+			if t.deadline <= next {
+				next = t.deadline
+				found = true
+			}
+		}
+	}
+
+	if !found || next <= s.z.now {
+		return false
+	}
+
+	if s.z.c.Debug {
+		log.Printf("[   S] advancing time from %d to %d", s.z.now, next)
+	}
+	s.z.now = next
+
+	return true
+}
+
+// pending returns the ids of the processes which may have pending events, in
+// increasing order. The processes left with nothing pending are forgotten on
+// the way.
+func (s *scheduler) pending() []int {
+	for pid := range s.net.recipients() {
+		s.active[pid] = true
+	}
+
+	pids := make([]int, 0, len(s.active))
+	for pid := range s.active {
+		if !s.busy(pid) {
+			delete(s.active, pid)
+			continue
+		}
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+
+	return pids
+}
+
+// busy tells if the process `pid` may have pending events
+func (s *scheduler) busy(pid int) bool {
+	_, ticked := s.ticks[pid]
+	return len(s.calls[pid]) > 0 || ticked || len(s.z.packs[pid].timers) > 0 || s.net.recipients()[pid]
+}
+
+// forget drops the calls and ticks of the process `pid`, which left
+func (s *scheduler) forget(pid int) {
+	delete(s.calls, pid)
+	delete(s.ticks, pid)
+	delete(s.active, pid)
+}
+
+// numbered sets Seq of the step to the number of the calls delivered so far
+// to the same process
+func (s *scheduler) numbered(st Step) Step {
+	st.Seq = s.seqs[st]
+	return st
+}
+
+// take removes the event of the step from the pending ones and returns it.
+// Only the payload is set for other steps than StepNet.
+func (s *scheduler) take(st Step) message {
+	switch st.Kind {
+	case StepNet:
+		return s.net.take(st.Pid, st.From, st.Seq)
+	case StepCall:
+		s.seqs[Step{Kind: StepCall, Pid: st.Pid}]++
+		call := s.calls[st.Pid][0]
+		s.calls[st.Pid] = s.calls[st.Pid][1:]
+		return message{payload: call}
+	case StepTick:
+		t := s.ticks[st.Pid]
+		delete(s.ticks, st.Pid)
+		return message{payload: t}
+	case StepTimer:
+		pack := s.z.packs[st.Pid]
+		for i, t := range pack.timers {
+			if t.id == st.Seq {
+				pack.timers = append(pack.timers[:i], pack.timers[i+1:]...)
+				return message{payload: t.payload}
+			}
+		}
+		return message{}
+	default:
+		log.Printf("[   S] unknown step kind %d", st.Kind)
+		return message{}
+	}
+}
+
+// discard drops the event of the step
+func (s *scheduler) discard(st Step) {
+	payload := s.take(st).payload
+	s.dropped = append(s.dropped, st)
+	if s.z.c.Debug {
+		log.Printf("[   S] dropping %s: %+v", st, payload)
+	}
+}
+
+func (s *scheduler) execute(st Step) {
+	pack := s.z.packs[st.Pid]
+
+	s.steps = append(s.steps, st)
+	m := s.take(st)
+	payload := m.payload
+
+	if s.z.c.Debug {
+		log.Printf("[   S] delivering %s: %+v", st, payload)
+	}
+
+	switch st.Kind {
+	case StepNet:
+		s.z.count(st.Pid, 0, 1)
+		e := Event{Kind: EventDeliver, Peer: st.From, Msg: m.id, Payload: payload, Clock: s.z.receive(st.Pid, m.clock)}
+		s.z.handle(pack, e, func() {
+			pack.process.ReceiveNet(st.From, payload)
+		})
+	case StepCall:
+		s.z.handle(pack, Event{Kind: EventCall, Payload: payload, Clock: s.z.stamp(st.Pid)}, func() {
+			pack.process.ReceiveCall(payload)
+		})
+	case StepTick:
+		t := s.z.clocks[st.Pid].duration(payload.(uint))
+		s.z.handle(pack, Event{Kind: EventTick, Payload: t, Clock: s.z.stamp(st.Pid)}, func() {
+			pack.process.Tick(t)
+		})
+	case StepTimer:
+		p, ok := pack.process.(TimerProcess)
+		if !ok {
+			log.Printf("[   S] process %d does not implement TimerProcess", st.Pid)
+			return
+		}
+		s.z.handle(pack, Event{Kind: EventTimer, Payload: payload, Clock: s.z.stamp(st.Pid)}, func() {
+			p.ReceiveTimer(st.Seq, payload)
+		})
+	}
+}
+
+func (s *scheduler) setTimer(pid int, after uint, payload interface{}) int {
+	pack := s.z.packs[pid]
+
+	c := s.z.clocks[pid]
+	local := c.local(s.z.now) + after
+
+	s.active[pid] = true
+	pack.timerID++
+	pack.timers = append(pack.timers, &timer{
+		id:       pack.timerID,
+		local:    local,
+		deadline: c.deadline(s.z.now, local),
+		payload:  payload,
+	})
+
+	return pack.timerID
+}
+
+func (s *scheduler) cancelTimer(pid int, id int) {
+	pack := s.z.packs[pid]
+
+	for i, t := range pack.timers {
+		if t.id == id {
+			pack.timers = append(pack.timers[:i], pack.timers[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *scheduler) call(pid int, payload interface{}) {
+	s.calls[pid] = append(s.calls[pid], payload)
+	s.active[pid] = true
+}
+
+func (s *scheduler) collectReturn(pid int, payload interface{}) {
+	clock := s.z.stamp(pid)
+	s.z.emit(Event{Kind: EventReturn, Pid: pid, Payload: payload, Clock: clock})
+	s.z.collect(pid, entryResponse, payload, clock)
+}
+
+func (s *scheduler) collectTrace(pid int, payload interface{}) {
+	clock := s.z.stamp(pid)
+	s.z.emit(Event{Kind: EventTrace, Pid: pid, Payload: payload, Clock: clock})
+	s.z.collect(pid, entryTrace, payload, clock)
+}
+
+func (s *scheduler) collectFault(f Fault, clock VectorClock) {
+	s.z.collect(f.From, entryFault, f, clock)
+}
+
+func equalPids(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,254 @@
+package zmey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// relayProcess passes each call around the ring of `scale` processes, `hops`
+// times, and returns it at the process where it stops.
+type relayProcess struct {
+	pid     int
+	scale   int
+	sendF   func(to int, payload interface{})
+	returnF func(payload interface{})
+	traceF  func(payload interface{})
+}
+
+type relayMessage struct {
+	ID   int
+	Hops int
+}
+
+func newRelayProcess(pid, scale int) Process {
+	return &relayProcess{pid: pid, scale: scale}
+}
+
+func (p *relayProcess) Init(
+	sendF func(to int, payload interface{}),
+	returnF func(payload interface{}),
+	traceF func(payload interface{}),
+	errorF func(error),
+) {
+	p.sendF = sendF
+	p.returnF = returnF
+	p.traceF = traceF
+}
+
+func (p *relayProcess) ReceiveNet(from int, payload interface{}) {
+	p.relay(payload.(relayMessage))
+}
+
+func (p *relayProcess) ReceiveCall(payload interface{}) {
+	p.relay(payload.(relayMessage))
+}
+
+func (p *relayProcess) Tick(t uint) {
+	p.traceF(fmt.Sprintf("%d tick %d", p.pid, t))
+}
+
+func (p *relayProcess) relay(msg relayMessage) {
+	p.traceF(fmt.Sprintf("%d relay %d/%d", p.pid, msg.ID, msg.Hops))
+	if msg.Hops == 0 {
+		p.returnF(msg.ID)
+		return
+	}
+	msg.Hops--
+	p.sendF((p.pid+1)%p.scale, msg)
+}
+
+func runRelay(t *testing.T, seed int64) (map[int][]interface{}, map[int][]interface{}) {
+	const scale = 5
+	const perNode = 4
+
+	z := NewZmey(&Config{
+		Deterministic: true,
+		Seed:          seed,
+	})
+
+	for pid := 0; pid < scale; pid++ {
+		z.SetProcess(pid, newRelayProcess(pid, scale))
+	}
+
+	z.Inject(func(pid int, c Client) {
+		for k := 0; k < perNode; k++ {
+			c.Call(relayMessage{ID: pid*perNode + k, Hops: k + 1})
+		}
+	})
+	z.Tick(7)
+
+	ctx, cancelF := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancelF()
+
+	responses, traces, err := z.Round(ctx)
+	require.NoError(t, err)
+
+	count := 0
+	for pid := range responses {
+		count += len(responses[pid])
+	}
+	require.Equal(t, scale*perNode, count)
+
+	return responses, traces
+}
+
+func TestDeterministicSameSeed(t *testing.T) {
+	responsesA, tracesA := runRelay(t, 42)
+	responsesB, tracesB := runRelay(t, 42)
+
+	assert.Equal(t, responsesA, responsesB)
+	assert.Equal(t, tracesA, tracesB)
+}
+
+func TestDeterministicDifferentSeed(t *testing.T) {
+	_, tracesA := runRelay(t, 1)
+	_, tracesB := runRelay(t, 2)
+
+	assert.NotEqual(t, tracesA, tracesB)
+}
+
+func TestDeterministicFilter(t *testing.T) {
+	z := NewZmey(&Config{Deterministic: true})
+
+	for pid := 0; pid < 3; pid++ {
+		z.SetProcess(pid, newRelayProcess(pid, 3))
+	}
+
+	z.Inject(func(pid int, c Client) {
+		c.Call(relayMessage{ID: pid, Hops: 1})
+	})
+	z.Filter(func(from, to int) bool {
+		return from != 1
+	})
+
+	responses, _, err := z.Round(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, map[int][]interface{}{
+		0: {2},
+		1: {0},
+		2: nil,
+	}, responses)
+}
+
+// heartbeatProcess traces the time of its heartbeats, armed every `period`.
+// A call cancels the next heartbeat.
+type heartbeatProcess struct {
+	apiProcess
+	period uint
+	next   int
+}
+
+func (p *heartbeatProcess) BindAPI(a API) {
+	p.apiProcess.BindAPI(a)
+	p.next = a.SetTimer(p.period, "heartbeat")
+}
+
+func (p *heartbeatProcess) ReceiveCall(interface{}) {
+	p.api.CancelTimer(p.next)
+}
+
+func (p *heartbeatProcess) ReceiveTimer(id int, payload interface{}) {
+	p.api.Trace(fmt.Sprintf("%s %d at %d", payload, id, p.api.Now()))
+	p.next = p.api.SetTimer(p.period, payload)
+}
+
+func TestTimers(t *testing.T) {
+	z := NewZmey(&Config{Deterministic: true})
+	z.SetProcess(0, &heartbeatProcess{period: 10})
+	z.SetProcess(1, &heartbeatProcess{period: 15})
+
+	_, traces, err := z.Round(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[int][]interface{}{0: nil, 1: nil}, traces)
+	assert.Equal(t, uint(0), z.Now())
+
+	z.Advance(35)
+	_, traces, err = z.Round(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[int][]interface{}{
+		0: {"heartbeat 1 at 10", "heartbeat 2 at 20", "heartbeat 3 at 30"},
+		1: {"heartbeat 1 at 15", "heartbeat 2 at 30"},
+	}, traces)
+	assert.Equal(t, uint(35), z.Now())
+
+	z.Inject(func(pid int, c Client) {
+		if pid == 1 {
+			c.Call(struct{}{})
+		}
+	})
+	z.Advance(10)
+	_, traces, err = z.Round(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[int][]interface{}{
+		0: {"heartbeat 4 at 40"},
+		1: nil,
+	}, traces)
+	assert.Equal(t, uint(45), z.Now())
+}
+
+func TestTimersConcurrent(t *testing.T) {
+	z := NewZmey(&Config{})
+	z.SetProcess(0, &heartbeatProcess{period: 10})
+
+	_, traces, err := z.Round(context.Background())
+	assert.Equal(t, map[int][]interface{}{0: nil}, traces)
+
+	var e *FailedError
+	require.True(t, errors.As(err, &e))
+	require.Len(t, e.Errors[0], 1)
+	assert.True(t, errors.Is(e.Errors[0][0].Payload.(error), ErrNotDeterministic))
+}
+
+func TestDeterministicResetOptions(t *testing.T) {
+	z := newTestZmey(&Config{Deterministic: true}, 2, newPingProcess, 1)
+
+	z.Faults(RandomFaults(FaultRates{Drop: 1}))
+	z.Latency(FixedLatency(10))
+	_, _, err := z.Round(context.Background())
+	require.NoError(t, err)
+
+	// The Net is reused by the next Round, without the options
+	z.Faults(nil)
+	z.Latency(nil)
+	z.Inject(callFirst(1))
+	now := z.Now()
+	responses, traces, err := z.Round(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, map[int][]interface{}{0: {now}, 1: nil}, responses)
+	assert.Equal(t, map[int][]interface{}{0: nil, 1: {now}}, traces)
+
+	collect := func(pid int, c Client) {
+		if pid == 1 {
+			for k := 0; k < 4; k++ {
+				c.Call(k)
+			}
+		}
+	}
+	unordered := func(from, to int) Ordering {
+		return Unordered
+	}
+	for seed := int64(0); seed < 20; seed++ {
+		z := NewZmey(&Config{Deterministic: true, Seed: seed})
+		z.SetProcess(0, newCollectorProcess(0))
+		z.SetProcess(1, newCollectorProcess(1))
+
+		z.Ordering(unordered)
+		z.Inject(collect)
+		_, _, err := z.Round(context.Background())
+		require.NoError(t, err)
+
+		z.Ordering(nil)
+		z.Inject(collect)
+		responses, _, err := z.Round(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []interface{}{0, 1, 2, 3}, responses[0])
+	}
+}
@@ -6,13 +6,33 @@ import (
 	"time"
 )
 
-// Session manages locks and stats for Net and Zmey
+// flight is a kind of work in flight during a Round
+type flight int
+
+const (
+	// flightStart counts the processes being started
+	flightStart flight = iota
+	// flightInject counts the running injectors
+	flightInject
+	flightCall
+	flightMessage
+	flightTick
+	flightMembership
+	flightReturn
+	flightTrace
+	flightKinds
+)
+
+// Session manages locks and stats for Net and Zmey. It tracks the calls,
+// messages, ticks, returns and traces in flight, so that the Round ends as
+// soon as none is left.
 type Session struct {
 	sync.Mutex
 
-	networkIdle bool
-	processIdle map[int]bool
-	collectIdle bool
+	inFlight [flightKinds]int
+	pending  int
+	idleC    chan struct{}
+	busyC    chan struct{}
 
 	tNetwork       time.Time
 	tNetworkSelect time.Time
@@ -35,25 +55,93 @@ type Session struct {
 // NewSession creates and returns a new instance of Session
 func NewSession() *Session {
 	s := Session{
-		processIdle:    make(map[int]bool),
+		idleC:          make(chan struct{}),
+		busyC:          make(chan struct{}),
 		tProcess:       make(map[int]time.Time),
 		tProcessSelect: make(map[int]time.Time),
 		tProcessSleep:  make(map[int]time.Time),
 		dProcessSelect: make(map[int]time.Duration),
 		dProcessSleep:  make(map[int]time.Duration),
 	}
+	close(s.idleC)
 
 	return &s
 }
 
+// begin reports an item of work of the given kind in flight. The work must
+// be reported before the goroutine doing it is unblocked, so that the
+// counters never drop to zero while some work is left. begin is a no-op on a
+// nil Session.
+func (s *Session) begin(kind flight) {
+	if s == nil {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s.pending == 0 {
+		s.idleC = make(chan struct{})
+		close(s.busyC)
+	}
+	s.pending++
+	s.inFlight[kind]++
+}
+
+// end reports an item of work of the given kind is done. end is a no-op on a
+// nil Session.
+func (s *Session) end(kind flight) {
+	if s == nil {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.pending--
+	s.inFlight[kind]--
+	if s.pending == 0 {
+		close(s.idleC)
+		s.busyC = make(chan struct{})
+	}
+}
+
+// unprocessed tells if processes are left to start, or calls, messages,
+// ticks or membership events to process
+func (s *Session) unprocessed() bool {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, kind := range []flight{flightStart, flightCall, flightMessage, flightTick, flightMembership} {
+		if s.inFlight[kind] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// idle returns a channel closed once no work is in flight
+func (s *Session) idle() <-chan struct{} {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.idleC
+}
+
+// busy returns a channel closed once some work is in flight
+func (s *Session) busy() <-chan struct{} {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.busyC
+}
+
 // ReportNetworkIdle reports the network is in idle state
 func (s *Session) ReportNetworkIdle() {
 	s.Lock()
 	defer s.Unlock()
 
 	s.tNetworkSleep = time.Now()
-
-	s.networkIdle = true
 }
 
 // ReportNetworkBusy reports the network is in busy state
@@ -62,8 +150,6 @@ func (s *Session) ReportNetworkBusy() {
 	defer s.Unlock()
 
 	s.dNetworkSleep += time.Since(s.tNetworkSleep)
-
-	s.networkIdle = false
 }
 
 // ReportCollectIdle reports the collect function is in idle state
@@ -72,8 +158,6 @@ func (s *Session) ReportCollectIdle() {
 	defer s.Unlock()
 
 	s.tCollectSleep = time.Now()
-
-	s.collectIdle = true
 }
 
 // ReportCollectBusy reports the collect function is in busy state
@@ -82,8 +166,6 @@ func (s *Session) ReportCollectBusy() {
 	defer s.Unlock()
 
 	s.dCollectSleep += time.Since(s.tCollectSleep)
-
-	s.collectIdle = false
 }
 
 // ReportProcessIdle reports the process with id `pid` is in idle state
@@ -92,8 +174,6 @@ func (s *Session) ReportProcessIdle(pid int) {
 	defer s.Unlock()
 
 	s.tProcessSleep[pid] = time.Now()
-
-	s.processIdle[pid] = true
 }
 
 // ReportProcessBusy reports the process with id `pid` is in busy state
@@ -102,8 +182,6 @@ func (s *Session) ReportProcessBusy(pid int) {
 	defer s.Unlock()
 
 	s.dProcessSleep[pid] += time.Since(s.tProcessSleep[pid])
-
-	s.processIdle[pid] = false
 }
 
 // ProfNetworkStart should be called right after network is started
@@ -178,88 +256,50 @@ func (s *Session) ProfProcessSelectEnd(pid int) {
 	s.dProcessSelect[pid] += time.Since(s.tProcessSelect[pid])
 }
 
-// IsIdle returns `true` if all network, collect function and all processes are
-// in idle state. Otherwise it returns false
+// IsIdle returns `true` if no call, message, tick, return or trace is in
+// flight, and no process or injector is being run. Otherwise it returns false
 func (s *Session) IsIdle() bool {
 	s.Lock()
 	defer s.Unlock()
 
-	if !s.networkIdle {
-		return false
-	}
-
-	if !s.collectIdle {
-		return false
-	}
-
-	for _, v := range s.processIdle {
-		if !v {
-			return false
-		}
-	}
-
-	return true
+	return s.pending == 0
 }
 
 // WaitIdle blocks until IsIdle is true
 func (s *Session) WaitIdle() {
-	for {
-		if s.IsIdle() {
-			return
-		}
-		time.Sleep(10 * time.Millisecond)
-	}
+	<-s.idle()
 }
 
 // WaitBusy blocks until IsIdle is false
 func (s *Session) WaitBusy() {
-	for {
-		if !s.IsIdle() {
-			return
-		}
-		time.Sleep(10 * time.Millisecond)
-	}
+	<-s.busy()
 }
 
-// Status retuns string representation of active/idle network, collect function and processes.
+// Status retuns string representation of the work in flight: the number of
+// processes being started, of running injectors, and of calls, messages,
+// ticks, membership events, returns and traces not yet processed.
 func (s *Session) Status() string {
 	s.Lock()
 	defer s.Unlock()
 
-	str := "n["
-	if s.networkIdle {
-		str += " "
-	} else {
-		str += "A"
-	}
-
-	str += "] c["
-
-	if s.collectIdle {
-		str += " "
-	} else {
-		str += "A"
-	}
-
-	str += "] pp["
-	for i := 0; i < len(s.processIdle); i++ {
-		if s.processIdle[i] {
-			str += " "
-		} else {
-			str += "A"
-		}
-	}
-
-	str += "]"
-
-	return str
+	return fmt.Sprintf("start %d inject %d call %d msg %d tick %d member %d return %d trace %d",
+		s.inFlight[flightStart],
+		s.inFlight[flightInject],
+		s.inFlight[flightCall],
+		s.inFlight[flightMessage],
+		s.inFlight[flightTick],
+		s.inFlight[flightMembership],
+		s.inFlight[flightReturn],
+		s.inFlight[flightTrace],
+	)
 }
 
 // Profs returns a string that describes where goroutines spend its time.
 // For network, collect and (average of) all processes a triple is returned.
+// In a Round, the processes are profiled by the workers running them.
 // First value in the triple corresponds to the actual time spend on execution,
 // second value -- time spent waiting at select, third value -- time spent
-// waiting at time.Sleep. The values in the triple sum up to 100 (percent).
+// reported idle. The values in the triple sum up to 100 (percent).
 func (s *Session) Profs() string {
 	s.Lock()
 	defer s.Unlock()
@@ -107,3 +107,61 @@ func TestProfs(t *testing.T) {
 	assert.InDelta(t, 20, pi, delta)
 
 }
+
+func TestSessionIdle(t *testing.T) {
+	session := NewSession()
+
+	assert.True(t, session.IsIdle())
+	session.WaitIdle()
+
+	session.begin(flightCall)
+	session.begin(flightMessage)
+	session.begin(flightMessage)
+	assert.False(t, session.IsIdle())
+	assert.Equal(t, "start 0 inject 0 call 1 msg 2 tick 0 member 0 return 0 trace 0", session.Status())
+
+	idleC := session.idle()
+	session.end(flightCall)
+	session.end(flightMessage)
+	select {
+	case <-idleC:
+		t.Fatalf("idle while a message is in flight")
+	default:
+	}
+
+	session.end(flightMessage)
+	select {
+	case <-idleC:
+	case <-time.After(time.Second):
+		t.Fatalf("timeout")
+	}
+	assert.True(t, session.IsIdle())
+
+	// A nil session ignores the work
+	var none *Session
+	none.begin(flightTrace)
+	none.end(flightTrace)
+}
+
+func TestSessionBusy(t *testing.T) {
+	session := NewSession()
+
+	busyC := session.busy()
+	select {
+	case <-busyC:
+		t.Fatalf("busy while no work is in flight")
+	default:
+	}
+
+	go session.begin(flightCall)
+	session.WaitBusy()
+	assert.False(t, session.IsIdle())
+
+	session.end(flightCall)
+	session.WaitIdle()
+	select {
+	case <-session.busy():
+		t.Fatalf("busy once the work is done")
+	default:
+	}
+}
@@ -0,0 +1,95 @@
+package zmey
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrNoVectorClocks is returned by WriteShiViz if the events are not stamped
+// with vector clocks.
+var ErrNoVectorClocks = errors.New("events have no vector clocks")
+
+// ShiVizRegexp is the regular expression parsing the logs written by
+// WriteShiViz, to be pasted in ShiViz along with the log. The clock stops at
+// the first closing brace, since the event may contain some.
+const ShiVizRegexp = `(?<host>\S*) (?<clock>{[^}]*}) (?<event>.*)`
+
+// WriteShiViz writes the events as a ShiViz log, one event per line: the
+// host, i.e. the process, its vector clock and a description of the event.
+// ShiViz parses the log with ShiVizRegexp and draws the space-time diagram of
+// the Round. The events should be recorded with Config.Events and
+// Config.VectorClocks, otherwise ErrNoVectorClocks is returned.
+//
+// Only the events of the processes are written, buffer, filter-drop and done
+// events are left out. ShiViz expects the clock of each process to start at
+// one, so the counts of the previous Rounds are subtracted.
+func WriteShiViz(w io.Writer, events []Event) error {
+	// base is the count of each process before its first event
+	base := make(map[int]int)
+	for _, e := range events {
+		if !shivizEvent(e) {
+			continue
+		}
+		if e.Clock == nil {
+			return ErrNoVectorClocks
+		}
+		if _, ok := base[e.Pid]; !ok {
+			base[e.Pid] = e.Clock[e.Pid] - 1
+		}
+	}
+
+	b := bufio.NewWriter(w)
+
+	for _, e := range events {
+		if !shivizEvent(e) {
+			continue
+		}
+
+		// The processes without events are left out of the clocks
+		clock := make(map[string]int)
+		for pid, n := range e.Clock {
+			start, ok := base[pid]
+			if n -= start; ok && n > 0 {
+				clock[shivizHost(pid)] = n
+			}
+		}
+		// encoding/json sorts the keys of maps
+		data, err := json.Marshal(clock)
+		if err != nil {
+			return err
+		}
+
+		var text string
+		switch e.Kind {
+		case EventSend:
+			text = fmt.Sprintf("send to %d: %+v", e.Peer, e.Payload)
+		case EventDeliver:
+			text = fmt.Sprintf("deliver from %d: %+v", e.Peer, e.Payload)
+		default:
+			text = fmt.Sprintf("%s: %+v", e.Kind, e.Payload)
+		}
+		text = strings.Replace(text, "\n", " ", -1)
+
+		fmt.Fprintf(b, "%s %s %s\n", shivizHost(e.Pid), data, text)
+	}
+
+	return b.Flush()
+}
+
+// shivizEvent tells if the event is stamped with the clock of its process
+func shivizEvent(e Event) bool {
+	switch e.Kind {
+	case EventBuffer, EventFilterDrop, EventFault, EventDone:
+		return false
+	default:
+		return true
+	}
+}
+
+func shivizHost(pid int) string {
+	return fmt.Sprintf("p%d", pid)
+}
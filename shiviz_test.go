@@ -0,0 +1,102 @@
+package zmey
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteShiViz(t *testing.T) {
+	z := newTestZmey(&Config{Deterministic: true, Events: true, VectorClocks: true}, 2, newPingProcess, 1)
+	z.Latency(FixedLatency(5))
+
+	result, err := z.Run(context.Background())
+	require.NoError(t, err)
+
+	var b bytes.Buffer
+	require.NoError(t, WriteShiViz(&b, result.Events))
+
+	assert.Equal(t, `p0 {"p0":1} call: 1
+p0 {"p0":2} send to 1: ping
+p1 {"p0":2,"p1":1} deliver from 0: ping
+p1 {"p0":2,"p1":2} trace: 5
+p1 {"p0":2,"p1":3} send to 0: pong
+p0 {"p0":3,"p1":3} deliver from 1: pong
+p0 {"p0":4,"p1":3} return: 10
+`, b.String())
+
+	// The clocks of the next Round start at one again
+	z.Inject(callFirst(1))
+	result, err = z.Run(context.Background())
+	require.NoError(t, err)
+
+	b.Reset()
+	require.NoError(t, WriteShiViz(&b, result.Events))
+
+	lines := strings.Split(b.String(), "\n")
+	assert.Equal(t, `p0 {"p0":1} call: 1`, lines[0])
+	assert.Equal(t, `p1 {"p0":2,"p1":1} deliver from 0: ping`, lines[2])
+}
+
+type shivizCall struct {
+	ID      int
+	Payload string
+}
+
+type shivizTimestampedCall struct {
+	Call      shivizCall
+	Timestamp int
+}
+
+func TestShiVizRegexp(t *testing.T) {
+	events := []Event{{
+		Kind:    EventTrace,
+		Pid:     0,
+		Payload: shivizTimestampedCall{Call: shivizCall{ID: 1, Payload: "x"}, Timestamp: 3},
+		Clock:   VectorClock{0: 2},
+	}, {
+		Kind:    EventSend,
+		Pid:     0,
+		Peer:    1,
+		Payload: map[string]int{"a": 1},
+		Clock:   VectorClock{0: 3},
+	}}
+
+	var b bytes.Buffer
+	require.NoError(t, WriteShiViz(&b, events))
+
+	// ShiViz uses the JavaScript syntax of named groups
+	re := regexp.MustCompile(strings.Replace(ShiVizRegexp, "(?<", "(?P<", -1))
+
+	expected := []struct{ host, clock, event string }{
+		{"p0", `{"p0":1}`, "trace: {Call:{ID:1 Payload:x} Timestamp:3}"},
+		{"p0", `{"p0":2}`, "send to 1: map[a:1]"},
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	require.Len(t, lines, len(expected))
+	for i, line := range lines {
+		match := re.FindStringSubmatch(line)
+		require.NotNil(t, match, line)
+		assert.Equal(t, expected[i].host, match[re.SubexpIndex("host")])
+		assert.Equal(t, expected[i].clock, match[re.SubexpIndex("clock")])
+		assert.Equal(t, expected[i].event, match[re.SubexpIndex("event")])
+		assert.True(t, json.Valid([]byte(match[re.SubexpIndex("clock")])))
+	}
+}
+
+func TestWriteShiVizNoClocks(t *testing.T) {
+	z := newTestZmey(&Config{Deterministic: true}, 2, newPingProcess, 1)
+	z.c.Events = true
+
+	result, err := z.Run(context.Background())
+	require.NoError(t, err)
+
+	var b bytes.Buffer
+	assert.Equal(t, ErrNoVectorClocks, WriteShiViz(&b, result.Events))
+}
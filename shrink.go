@@ -0,0 +1,203 @@
+package zmey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNoViolation is returned by Shrink if the replay does not violate the
+// invariant of the scenario.
+var ErrNoViolation = errors.New("replay does not violate the invariant")
+
+// Shrink looks for a smaller schedule violating the invariant of the scenario.
+// `r` is the replay of a failing Round of the scenario, e.g. recorded with
+// Config.Record, or found by Explore. The scenario is executed again and
+// again, while removing steps from the schedule (the events are either left
+// pending or dropped, as a filter would do) and moving them around.
+//
+// The returned replay stops right after the violation. It can be saved, passed
+// to Config.Replay, or printed as a list of steps.
+func Shrink(ctx context.Context, s *Scenario, r *Replay) (*Replay, error) {
+	if len(r.Rounds) != 1 {
+		return nil, fmt.Errorf("cannot shrink %d rounds, a single one is expected", len(r.Rounds))
+	}
+
+	shrinker := shrinker{ctx: ctx, scenario: s, seed: r.Seed}
+
+	best, ok, err := shrinker.try(r.Rounds[0])
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNoViolation
+	}
+
+	for n := len(best.Steps) / 2; n >= 1; {
+		changed := false
+		for i := 0; i < len(best.Steps); {
+			end := i + n
+			if end > len(best.Steps) {
+				end = len(best.Steps)
+			}
+
+			removed := best.Steps[i:end]
+			steps := append(copySteps(best.Steps[:i]), best.Steps[end:]...)
+
+			candidates := []Schedule{
+				{Steps: steps, Drops: best.Drops},
+				{Steps: steps, Drops: append(copySteps(best.Drops), removed...)},
+			}
+
+			found := false
+			for _, candidate := range candidates {
+				result, ok, err := shrinker.try(candidate)
+				if err != nil {
+					return nil, err
+				}
+				if ok && len(result.Steps) < len(best.Steps) {
+					best = result
+					found = true
+					break
+				}
+			}
+
+			if found {
+				changed = true
+			} else {
+				i += n
+			}
+		}
+
+		if !changed {
+			n /= 2
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for i := 0; i+1 < len(best.Steps); i++ {
+			if !stepLess(best.Steps[i+1], best.Steps[i]) {
+				continue
+			}
+
+			steps := copySteps(best.Steps)
+			steps[i], steps[i+1] = steps[i+1], steps[i]
+
+			result, ok, err := shrinker.try(Schedule{Steps: steps, Drops: best.Drops})
+			if err != nil {
+				return nil, err
+			}
+			if ok && schedulesLess(result.Steps, best.Steps) {
+				best = result
+				changed = true
+			}
+		}
+	}
+
+	return &Replay{Seed: r.Seed, Rounds: []Schedule{best}}, nil
+}
+
+type shrinker struct {
+	ctx      context.Context
+	scenario *Scenario
+	seed     int64
+}
+
+// try runs the scenario, following the steps of the schedule as far as
+// possible. Since removing a step renumbers the following events of the same
+// link, a step whose event is not pending is matched with any pending event
+// of the same link; if there is none, the step is skipped. It returns the
+// actual schedule, and whether it violated the invariant.
+func (s *shrinker) try(schedule Schedule) (Schedule, bool, error) {
+	z := s.scenario.zmey(&Config{Seed: s.seed})
+
+	var next int
+	choose := func(steps []Step) (int, error) {
+		for ; next < len(schedule.Steps); next++ {
+			st := schedule.Steps[next]
+			match := -1
+			for i := range steps {
+				if steps[i] == st {
+					match = i
+					break
+				}
+				if match == -1 && steps[i].Kind == st.Kind && steps[i].Pid == st.Pid && steps[i].From == st.From {
+					match = i
+				}
+			}
+			if match != -1 {
+				next++
+				return match, nil
+			}
+		}
+		return 0, errStop
+	}
+
+	z.Lock()
+	defer z.Unlock()
+
+	err := z.roundDeterministic(s.ctx, s.scenario.checked(z, choose), schedule.Drops)
+	switch {
+	case err == nil:
+		return Schedule{}, false, nil
+	case errors.Is(err, ErrInvariantViolated):
+		result := z.replay.Rounds[0]
+		result.Partial = true
+		return result, true, nil
+	default:
+		return Schedule{}, false, err
+	}
+}
+
+// stepLess orders the steps by process, so that shrunk schedules group
+// the steps of each process together when possible
+func stepLess(a, b Step) bool {
+	if a.Pid != b.Pid {
+		return a.Pid < b.Pid
+	}
+	if a.Kind != b.Kind {
+		return a.Kind < b.Kind
+	}
+	if a.From != b.From {
+		return a.From < b.From
+	}
+	return a.Seq < b.Seq
+}
+
+// schedulesLess tells if the steps `a` are shorter than `b`, or equally long
+// but lexicographically smaller
+func schedulesLess(a, b []Step) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return stepLess(a[i], b[i])
+		}
+	}
+	return false
+}
+
+// String returns the human-readable list of steps of the replay
+func (r *Replay) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "seed %d\n", r.Seed)
+	for i, schedule := range r.Rounds {
+		fmt.Fprintf(&b, "round %d", i)
+		if schedule.Partial {
+			b.WriteString(" (partial)")
+		}
+		b.WriteString("\n")
+		for j, st := range schedule.Steps {
+			fmt.Fprintf(&b, "%6d. %s\n", j+1, st)
+		}
+		for _, st := range schedule.Drops {
+			fmt.Fprintf(&b, "  drop %s\n", st)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,119 @@
+package zmey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingReplay runs the scenario with different seeds until the invariant
+// is violated
+func failingReplay(t *testing.T, s *Scenario) *Replay {
+	for seed := int64(0); seed < 100; seed++ {
+		path := fmt.Sprintf("%s/%d.json", t.TempDir(), seed)
+		_, _, err := s.Run(context.Background(), &Config{Seed: seed, Record: path})
+		if errors.Is(err, ErrInvariantViolated) {
+			replay, err := LoadReplay(path)
+			require.NoError(t, err)
+			return replay
+		}
+		require.NoError(t, err)
+	}
+
+	t.Fatalf("invariant is never violated")
+	return nil
+}
+
+func TestShrink(t *testing.T) {
+	s := newCollectorScenario(4)
+	s.Invariant = func(responses, traces map[int][]interface{}) error {
+		for _, payload := range responses[0] {
+			if payload == 3 {
+				return errors.New("process 3 reached process 0")
+			}
+		}
+		return nil
+	}
+
+	replay := failingReplay(t, s)
+	require.True(t, len(replay.Rounds[0].Steps) > 2)
+
+	shrunk, err := Shrink(context.Background(), s, replay)
+	require.NoError(t, err)
+
+	assert.Equal(t, []Schedule{{
+		Steps: []Step{
+			{Kind: StepCall, Pid: 3},
+			{Kind: StepNet, Pid: 0, From: 3},
+		},
+		Partial: true,
+	}}, shrunk.Rounds)
+	assert.Equal(t, "seed "+fmt.Sprint(replay.Seed)+`
+round 0 (partial)
+     1. call 3 #0
+     2. net 3 -> 0 #0
+`, shrunk.String())
+
+	_, _, err = s.Run(context.Background(), &Config{Replay: shrunk})
+	assert.True(t, errors.Is(err, ErrInvariantViolated), "unexpected error %v", err)
+}
+
+func TestShrinkDrop(t *testing.T) {
+	s := newCollectorScenario(2)
+	s.Inject = func(pid int, c Client) {
+		switch pid {
+		case 1:
+			c.Call(10)
+			c.Call(1)
+		case 2:
+			c.Call(2)
+		}
+	}
+	s.Invariant = func(responses, traces map[int][]interface{}) error {
+		for _, payload := range responses[0] {
+			if payload == 1 {
+				return errors.New("payload 1 reached process 0")
+			}
+		}
+		return nil
+	}
+
+	replay := failingReplay(t, s)
+
+	shrunk, err := Shrink(context.Background(), s, replay)
+	require.NoError(t, err)
+
+	// The first call of process 1 has to be dropped, otherwise its message
+	// would be ahead of the failing one
+	assert.Equal(t, []Schedule{{
+		Steps: []Step{
+			{Kind: StepCall, Pid: 1, Seq: 1},
+			{Kind: StepNet, Pid: 0, From: 1},
+		},
+		Drops: []Step{
+			{Kind: StepCall, Pid: 1},
+		},
+		Partial: true,
+	}}, shrunk.Rounds)
+
+	_, _, err = s.Run(context.Background(), &Config{Replay: shrunk})
+	assert.True(t, errors.Is(err, ErrInvariantViolated), "unexpected error %v", err)
+}
+
+func TestShrinkNoViolation(t *testing.T) {
+	s := newCollectorScenario(2)
+
+	_, _, err := s.Run(context.Background(), &Config{})
+	require.NoError(t, err)
+
+	z := s.zmey(&Config{})
+	_, _, err = z.Round(context.Background())
+	require.NoError(t, err)
+
+	_, err = Shrink(context.Background(), s, z.Replay())
+	assert.Equal(t, ErrNoViolation, err)
+}
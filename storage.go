@@ -0,0 +1,165 @@
+package zmey
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// Storage is the simulated disk of a process. It survives crashes and
+// restarts, except for the writes which are not synced yet: their fate is
+// decided by the CrashPolicy of Zmey.
+type Storage interface {
+	// Write stores a copy of `data` at `key`
+	Write(key string, data []byte)
+	// Delete removes `key`
+	Delete(key string)
+	// Sync makes the previous writes and deletes durable
+	Sync()
+	// Read returns the data stored at `key`, including unsynced writes. ok
+	// is false if there is no such key.
+	Read(key string) (data []byte, ok bool)
+	// Keys returns the sorted list of the stored keys
+	Keys() []string
+}
+
+// StorageProcess is an optional interface of Process. BindStorage is called
+// right before Init (and BindAPI), each time the process is started, with the
+// same Storage.
+type StorageProcess interface {
+	BindStorage(Storage)
+}
+
+// CrashPolicy decides what remains of an unsynced write of the process `pid`
+// when it crashes. It returns the data to keep, possibly torn, and false if
+// the write is lost. `r` is the pseudo-random generator of the network.
+type CrashPolicy func(pid int, key string, data []byte, r *rand.Rand) ([]byte, bool)
+
+// LoseUnsynced loses all the unsynced writes, it's the default CrashPolicy
+func LoseUnsynced(int, string, []byte, *rand.Rand) ([]byte, bool) {
+	return nil, false
+}
+
+// KeepUnsynced keeps all the unsynced writes, as if they were synced
+func KeepUnsynced(pid int, key string, data []byte, r *rand.Rand) ([]byte, bool) {
+	return data, true
+}
+
+// TearUnsynced keeps each unsynced write with the probability `keep`, and
+// tears the kept ones with the probability `tear`: only a random prefix of
+// the data is written.
+func TearUnsynced(keep, tear float64) CrashPolicy {
+	return func(pid int, key string, data []byte, r *rand.Rand) ([]byte, bool) {
+		if r.Float64() >= keep {
+			return nil, false
+		}
+		if r.Float64() < tear {
+			return data[:r.Intn(len(data)+1)], true
+		}
+		return data, true
+	}
+}
+
+// StoragePolicy sets the policy applied to the unsynced writes when a process
+// crashes. If `policy` is `nil`, LoseUnsynced applies. StoragePolicy is
+// thread-safe.
+func (z *Zmey) StoragePolicy(policy CrashPolicy) {
+	z.Lock()
+	defer z.Unlock()
+
+	z.storagePolicy = policy
+}
+
+// storage implements Storage
+type storage struct {
+	durable map[string][]byte
+	pending []write
+}
+
+// write is an unsynced write, or a delete if `data` is nil
+type write struct {
+	key  string
+	data []byte
+}
+
+func newStorage() *storage {
+	return &storage{durable: make(map[string][]byte)}
+}
+
+func (s *storage) Write(key string, data []byte) {
+	s.pending = append(s.pending, write{key: key, data: append([]byte{}, data...)})
+}
+
+func (s *storage) Delete(key string) {
+	s.pending = append(s.pending, write{key: key})
+}
+
+func (s *storage) Sync() {
+	for _, w := range s.pending {
+		s.apply(w)
+	}
+	s.pending = nil
+}
+
+func (s *storage) Read(key string) ([]byte, bool) {
+	for i := len(s.pending) - 1; i >= 0; i-- {
+		if s.pending[i].key == key {
+			if s.pending[i].data == nil {
+				return nil, false
+			}
+			return append([]byte{}, s.pending[i].data...), true
+		}
+	}
+
+	data, ok := s.durable[key]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte{}, data...), true
+}
+
+func (s *storage) Keys() []string {
+	seen := make(map[string]bool)
+	for key := range s.durable {
+		seen[key] = true
+	}
+	for _, w := range s.pending {
+		seen[w.key] = true
+	}
+
+	keys := []string{}
+	for key := range seen {
+		if _, ok := s.Read(key); ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// crash applies the policy to the unsynced writes
+func (s *storage) crash(pid int, policy CrashPolicy, r *rand.Rand) {
+	if policy == nil {
+		policy = LoseUnsynced
+	}
+	for _, w := range s.pending {
+		if w.data == nil {
+			// Deletes are either applied or lost
+			if _, ok := policy(pid, w.key, nil, r); ok {
+				s.apply(w)
+			}
+			continue
+		}
+		if data, ok := policy(pid, w.key, w.data, r); ok {
+			s.apply(write{key: w.key, data: data})
+		}
+	}
+	s.pending = nil
+}
+
+func (s *storage) apply(w write) {
+	if w.data == nil {
+		delete(s.durable, w.key)
+		return
+	}
+	s.durable[w.key] = w.data
+}
@@ -0,0 +1,89 @@
+package zmey
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// logProcess appends each call to its log, and syncs it if the call is
+// "sync". It traces the log it finds when it starts.
+type logProcess struct {
+	DummyProcess
+	storage Storage
+}
+
+func (p *logProcess) BindStorage(s Storage) {
+	p.storage = s
+}
+
+func (p *logProcess) Init(
+	sendF func(to int, payload interface{}),
+	returnF func(payload interface{}),
+	traceF func(payload interface{}),
+	errorF func(error),
+) {
+	data, _ := p.storage.Read("log")
+	traceF(string(data))
+}
+
+func (p *logProcess) ReceiveCall(payload interface{}) {
+	if payload == "sync" {
+		p.storage.Sync()
+		return
+	}
+	data, _ := p.storage.Read("log")
+	p.storage.Write("log", append(data, payload.(string)...))
+}
+
+func runLog(t *testing.T, policy CrashPolicy) []interface{} {
+	z := NewZmey(&Config{Deterministic: true})
+	z.SetProcess(0, &logProcess{})
+	z.StoragePolicy(policy)
+
+	z.Inject(func(pid int, c Client) {
+		for _, call := range []string{"abc", "sync", "def", "ghi"} {
+			c.Call(call)
+		}
+	})
+	_, _, err := z.Round(context.Background())
+	require.NoError(t, err)
+
+	z.Crash(0, false)
+	z.Restart(0, func(int) Process { return &logProcess{} })
+
+	_, traces, err := z.Round(context.Background())
+	require.NoError(t, err)
+
+	return traces[0]
+}
+
+func TestStorage(t *testing.T) {
+	assert.Equal(t, []interface{}{"abc"}, runLog(t, nil))
+	assert.Equal(t, []interface{}{"abcdefghi"}, runLog(t, KeepUnsynced))
+
+	torn := runLog(t, TearUnsynced(1, 1))[0].(string)
+	assert.Equal(t, "abcdefghi"[:len(torn)], torn)
+}
+
+func TestStorageKeys(t *testing.T) {
+	s := newStorage()
+	s.Write("b", []byte("1"))
+	s.Write("a", nil)
+	s.Sync()
+	s.Delete("b")
+	s.Write("c", []byte("2"))
+
+	assert.Equal(t, []string{"a", "c"}, s.Keys())
+
+	data, ok := s.Read("a")
+	assert.True(t, ok)
+	assert.Empty(t, data)
+	_, ok = s.Read("b")
+	assert.False(t, ok)
+
+	s.crash(0, LoseUnsynced, nil)
+	assert.Equal(t, []string{"a", "b"}, s.Keys())
+}
@@ -0,0 +1,137 @@
+package zmey
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// VectorClock counts, for each process id, the events of the process known
+// to have happened. Missing ids count as zero. Clocks returned by Zmey must
+// not be modified.
+type VectorClock map[int]int
+
+// Before tells if the event stamped with `v` happened before the one stamped
+// with `o`
+func (v VectorClock) Before(o VectorClock) bool {
+	strict := false
+	for pid, n := range v {
+		if n > o[pid] {
+			return false
+		}
+		if n < o[pid] {
+			strict = true
+		}
+	}
+	if strict {
+		return true
+	}
+	for pid, n := range o {
+		if n > v[pid] {
+			return true
+		}
+	}
+	return false
+}
+
+// Concurrent tells if neither of the events stamped with `v` and `o`
+// happened before the other
+func (v VectorClock) Concurrent(o VectorClock) bool {
+	return !v.Before(o) && !o.Before(v) && !v.equal(o)
+}
+
+func (v VectorClock) equal(o VectorClock) bool {
+	for pid, n := range v {
+		if o[pid] != n {
+			return false
+		}
+	}
+	for pid, n := range o {
+		if v[pid] != n {
+			return false
+		}
+	}
+	return true
+}
+
+// pids returns the ids with a non-zero count, in increasing order
+func (v VectorClock) pids() []int {
+	pids := make([]int, 0, len(v))
+	for pid, n := range v {
+		if n > 0 {
+			pids = append(pids, pid)
+		}
+	}
+	sort.Ints(pids)
+	return pids
+}
+
+func (v VectorClock) String() string {
+	var b strings.Builder
+
+	b.WriteString("{")
+	for i, pid := range v.pids() {
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		fmt.Fprintf(&b, "%d:%d", pid, v[pid])
+	}
+	b.WriteString("}")
+
+	return b.String()
+}
+
+// stamp counts a new event of the process `pid` and returns its clock. It
+// returns nil unless Config.VectorClocks is set. stamp should be called on
+// behalf of the process, which is never run by two goroutines at a time.
+func (z *Zmey) stamp(pid int) VectorClock {
+	return z.receive(pid, nil)
+}
+
+// receive merges the clock `c` of a message into the clock of the process
+// `pid`, and counts the delivery as a new event, see stamp
+func (z *Zmey) receive(pid int, c VectorClock) VectorClock {
+	if !z.c.VectorClocks {
+		return nil
+	}
+	pack, ok := z.packs[pid]
+	if !ok {
+		return nil
+	}
+
+	clock := make(VectorClock, len(pack.clock)+1)
+	for p, n := range pack.clock {
+		clock[p] = n
+	}
+	for p, n := range c {
+		if n > clock[p] {
+			clock[p] = n
+		}
+	}
+	clock[pid]++
+
+	// The previous clock may be referenced by events, it's replaced
+	pack.clock = clock
+
+	return clock
+}
+
+// HappenedBefore tells if the event `e` happened before `o`, according to
+// their vector clocks. It requires Config.VectorClocks.
+func (e Event) HappenedBefore(o Event) bool {
+	return e.Clock.Before(o.Clock)
+}
+
+// Predecessors returns the recorded events which happened before the event
+// stamped with `c`, e.g. the Clock of a response, in the order of Seq. The
+// events without a clock are left out. It requires Config.Events and
+// Config.VectorClocks.
+func (r *RoundResult) Predecessors(c VectorClock) []Event {
+	events := []Event{}
+	for _, e := range r.Events {
+		if e.Clock != nil && e.Clock.Before(c) {
+			events = append(events, e)
+		}
+	}
+	return events
+}
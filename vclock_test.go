@@ -0,0 +1,119 @@
+package zmey
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVectorClock(t *testing.T) {
+	a := VectorClock{0: 1}
+	b := VectorClock{0: 2, 1: 1}
+	c := VectorClock{1: 2}
+
+	assert.True(t, a.Before(b))
+	assert.False(t, b.Before(a))
+	assert.False(t, a.Before(a))
+	assert.True(t, VectorClock(nil).Before(a))
+
+	assert.True(t, a.Concurrent(c))
+	assert.True(t, b.Concurrent(c))
+	assert.False(t, a.Concurrent(b))
+	assert.False(t, a.Concurrent(VectorClock{0: 1, 1: 0}))
+
+	assert.Equal(t, "{0:2 1:1}", b.String())
+}
+
+func TestVectorClocks(t *testing.T) {
+	z := newTestZmey(&Config{Deterministic: true, Events: true, VectorClocks: true}, 3, newPingProcess)
+	z.Inject(func(pid int, c Client) {
+		if pid == 0 {
+			c.Call(1)
+		}
+		if pid == 2 {
+			c.Call(1)
+		}
+	})
+
+	result, err := z.Run(context.Background())
+	require.NoError(t, err)
+
+	require.Len(t, result.Processes[0].Responses, 1)
+	response := result.Processes[0].Responses[0]
+
+	// The ping of 2 may or may not be delivered before the one of 0, only
+	// the events of the exchange between 0 and 1 are certain to precede the
+	// response
+	predecessors := map[EventKind]int{}
+	for _, e := range result.Predecessors(response.Clock) {
+		if e.Pid == 2 || e.Peer == 2 {
+			continue
+		}
+		predecessors[e.Kind]++
+	}
+	assert.Equal(t, map[EventKind]int{
+		EventCall:    1,
+		EventSend:    2,
+		EventBuffer:  2,
+		EventDeliver: 2,
+		EventTrace:   1,
+	}, predecessors)
+
+	var call0, call2 Event
+	for _, e := range result.Events {
+		if e.Kind == EventCall && e.Pid == 0 {
+			call0 = e
+		}
+		if e.Kind == EventCall && e.Pid == 2 {
+			call2 = e
+		}
+	}
+	assert.Equal(t, VectorClock{0: 1}, call0.Clock)
+	assert.True(t, call0.HappenedBefore(Event{Clock: response.Clock}))
+	assert.True(t, call0.Clock.Concurrent(call2.Clock))
+	assert.Equal(t, 4, response.Clock[0])
+}
+
+func TestVectorClocksReplace(t *testing.T) {
+	z := newTestZmey(&Config{Deterministic: true, Events: true, VectorClocks: true}, 2, newPingProcess, 1)
+
+	result, err := z.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Processes[0].Responses, 1)
+	last := result.Processes[0].Responses[0].Clock
+
+	// The new instance of 0 knows what its predecessor knew
+	z.SetProcess(0, newPingProcess(0))
+	z.Inject(callFirst(1))
+	result, err = z.Run(context.Background())
+	require.NoError(t, err)
+
+	require.Equal(t, EventCall, result.Events[0].Kind)
+	assert.True(t, Event{Clock: last}.HappenedBefore(result.Events[0]))
+}
+
+func TestVectorClocksConcurrent(t *testing.T) {
+	z := newTestZmey(&Config{Events: true, VectorClocks: true}, 4, newFanoutProcess, "broadcast")
+
+	result, err := z.Run(context.Background())
+	require.NoError(t, err)
+
+	sends := map[int]Event{}
+	delivers := 0
+	for _, e := range result.Events {
+		switch e.Kind {
+		case EventSend:
+			sends[e.Msg] = e
+		case EventDeliver:
+			delivers++
+			assert.True(t, sends[e.Msg].HappenedBefore(e))
+		}
+	}
+	assert.Equal(t, 3, delivers)
+
+	// The responses of different processes are concurrent
+	responses := result.Processes
+	assert.True(t, responses[1].Responses[0].Clock.Concurrent(responses[2].Responses[0].Clock))
+}
@@ -3,6 +3,9 @@ package zmey
 import (
 	"context"
 	"errors"
+	"log"
+	"math/rand"
+	"runtime"
 	"sort"
 	"sync"
 	"time"
@@ -14,16 +17,20 @@ var (
 	ErrIncorrectPid = errors.New("process id out of range")
 	// ErrCancelled is returned if the context is cancelled.
 	ErrCancelled = errors.New("context cancelled")
+	// ErrProcessFailed is wrapped by the error returned if processes reported
+	// errors or panicked during the Round, see FailedError.
+	ErrProcessFailed = errors.New("process failed")
+	// ErrNotDeterministic is reported by the processes arming or cancelling
+	// timers in a Round without Config.Deterministic, see API.SetTimer.
+	ErrNotDeterministic = errors.New("timers require deterministic mode")
 )
 
 const (
-	timeoutProcess = 10 * time.Millisecond
-	timeoutNetwork = 10 * time.Millisecond
-	timeoutCollect = 10 * time.Millisecond
-
-	sleepProcess = 100 * time.Millisecond
-	sleepNetwork = 100 * time.Millisecond
-	sleepCollect = 100 * time.Millisecond
+	// statusPeriod is the period at which Status and BufferStats are refreshed
+	statusPeriod = 100 * time.Millisecond
+	// maxBufferStats is the size of the largest network whose BufferStats
+	// are reported, larger tables are not readable anyway
+	maxBufferStats = 100
 )
 
 // Zmey is the core structure of the framework.
@@ -32,15 +39,52 @@ type Zmey struct {
 
 	c *Config
 
-	packs map[int]*pack
-	pids  []int
-
-	tick    uint
-	injectF InjectFunc
-	filterF FilterFunc
+	packs  map[int]*pack
+	pids   []int
+	groups map[string][]int
+
+	tick      uint
+	now       uint
+	advance   uint
+	clocks    map[int]*clock
+	timeline  []action
+	announced bool
+	net       *Net
+	sched     *scheduler
+	injectF   InjectFunc
+	filterF   FilterFunc
+	// nemesisF is the filter of the last step of the Nemesis, applied on top
+	// of filterF
+	nemesisF      FilterFunc
+	latency       LatencyModel
+	faultF        FaultFunc
+	orderingF     OrderingFunc
+	storagePolicy CrashPolicy
+
+	result     *RoundResult
+	resultLock sync.Mutex
+	collectC   chan collectItem
+	seq        int
+	failures   int
+	abortC     chan struct{}
+
+	subscribers []EventFunc
+	eventSeq    int
+	started     time.Time
+	// notified holds the events not yet passed to the subscribers, notifying
+	// tells that a goroutine is passing them
+	notified  []Event
+	notifying bool
+	// lastMsg is the id of the last message sent, carried from one Net to
+	// the next
+	lastMsg int64
 
 	statusC      chan string
 	bufferStatsC chan string
+
+	rng    *rand.Rand
+	netRng *rand.Rand
+	replay *Replay
 }
 
 // pack wraps Process and adds some context used by the framework
@@ -50,12 +94,21 @@ type pack struct {
 	isStarted bool
 	client    *client
 	api       *api
-	callC     chan interface{}
-	returnC   chan interface{}
-	traceC    chan interface{}
-	tickC     chan uint
-	responses []interface{}
-	traces    []interface{}
+	// lock protects the events queued for a concurrent Round, scheduled
+	// tells that the process is queued or running
+	lock      sync.Mutex
+	calls     []interface{}
+	ticks     []uint
+	scheduled bool
+	// membership holds the events not yet delivered to the process
+	membership []MembershipEvent
+	timers     []*timer
+	timerID    int
+	clock      VectorClock
+	// crashed processes receive nothing until they restart
+	crashed     bool
+	dropInbound bool
+	storage     *storage
 }
 
 // Process in the interface that has to be implemented by the distributed
@@ -79,10 +132,58 @@ type Process interface {
 	Tick(uint)
 }
 
+// APIProcess is an optional interface of Process. BindAPI is called once,
+// right before Init, and gives the process the complete API, including the
+// features that are not passed to Init.
+type APIProcess interface {
+	BindAPI(API)
+}
+
+// TimerProcess is an optional interface of Process. ReceiveTimer is called
+// by the framework when a timer armed with API.SetTimer fires.
+type TimerProcess interface {
+	ReceiveTimer(id int, payload interface{})
+}
+
+// MembershipProcess is an optional interface of Process. ReceiveMembership
+// is called by the framework when another process joins or leaves, see
+// SetProcess, JoinAt and LeaveAt.
+type MembershipProcess interface {
+	ReceiveMembership(MembershipEvent)
+}
+
 // Config is used to initialize new zmey.Zmey instance.
 type Config struct {
 	// Debug enables verbose logging
 	Debug bool
+	// Deterministic runs each Round on a single goroutine. Instead of
+	// racing, deliveries, calls and ticks are picked one at a time by a
+	// pseudo-random scheduler, so that the same seed always yields the same
+	// responses and traces. InjectFunc must perform its calls synchronously
+	// in this mode. Status and BufferStats are not reported.
+	Deterministic bool
+	// Seed initializes the pseudo-random scheduler used in deterministic mode
+	Seed int64
+	// Record is the path of a replay file. If set, the seed and the
+	// scheduling decisions are written to the file after each deterministic
+	// Round, so a failing run can be reproduced with Replay.
+	Record string
+	// Replay forces deterministic Rounds to follow a recorded schedule
+	// instead of picking the steps randomly. Its seed overrides Seed. Round
+	// returns ErrReplayDiverged if the processes no longer match the
+	// schedule.
+	Replay *Replay
+	// AbortOnError ends the Round as soon as a process reports an error or
+	// panics. In deterministic mode, the Round is recorded as partial.
+	AbortOnError bool
+	// Events records the events of each Round (see Event) in
+	// RoundResult.Events
+	Events bool
+	// VectorClocks stamps the messages, the events and the entries of the
+	// results with vector clocks, which tell which ones happened before the
+	// others. Clocks grow with the number of processes a process hears of,
+	// so they are not kept by default.
+	VectorClocks bool
 }
 
 // FactoryFunc creates an instance of a process provided the process id
@@ -102,52 +203,73 @@ type FilterFunc func(from int, to int) bool
 // NewZmey creates and returns an instance of Zmey framework.
 func NewZmey(c *Config) *Zmey {
 
+	seed := c.Seed
+	if c.Replay != nil {
+		seed = c.Replay.Seed
+	}
+
 	z := Zmey{
 		c:            c,
 		packs:        make(map[int]*pack),
 		pids:         []int{},
+		groups:       make(map[string][]int),
+		clocks:       make(map[int]*clock),
+		result:       newRoundResult(),
+		collectC:     make(chan collectItem),
 		statusC:      make(chan string),
 		bufferStatsC: make(chan string),
+		rng:          rand.New(rand.NewSource(seed)),
+		netRng:       rand.New(rand.NewSource(^seed)),
+		replay:       &Replay{Seed: seed},
 	}
 
 	return &z
 }
 
-// SetProcess adds/removes a process. If `process` is nil, it is removed.
-// The method is thread-safe.
+// SetProcess adds/removes a process. If `process` is nil, it is removed, and
+// taken out of the groups. The running processes implementing
+// MembershipProcess are told about the change at the beginning of the next
+// Round; replacing a process is not a change of membership, and the new
+// instance receives the events not yet delivered to the previous one. The
+// method is thread-safe.
 func (z *Zmey) SetProcess(pid int, process Process) {
 	z.Lock()
 	defer z.Unlock()
 
-	// Probably not the most elegant way of updating z.pids
-	defer func() {
-		z.pids = make([]int, len(z.packs))
-		var i int
-		for pid := range z.packs {
-			z.pids[i] = pid
-			i++
-		}
-		sort.Ints(z.pids)
-	}()
+	z.setProcess(pid, process)
+}
+
+func (z *Zmey) setProcess(pid int, process Process) {
+	// z.pids is never modified in place, as Net keeps a reference to it
+	i := sort.SearchInts(z.pids, pid)
+	old, exists := z.packs[pid]
 
 	if process == nil {
-		delete(z.packs, pid)
+		if exists {
+			delete(z.packs, pid)
+			z.pids = append(z.pids[:i:i], z.pids[i+1:]...)
+			z.ungroup(pid)
+			z.announce(MembershipEvent{Kind: MemberLeave, Pid: pid})
+		}
 		return
 	}
 
-	callC := make(chan interface{})
-	returnC := make(chan interface{})
-	traceC := make(chan interface{})
-	tickC := make(chan uint)
+	if !exists {
+		pids := make([]int, 0, len(z.pids)+1)
+		pids = append(pids, z.pids[:i]...)
+		pids = append(pids, pid)
+		z.pids = append(pids, z.pids[i:]...)
+		z.announce(MembershipEvent{Kind: MemberJoin, Pid: pid})
+	}
+
 	api := api{
-		pid:     pid,
-		returnC: returnC,
-		traceC:  traceC,
-		debug:   z.c.Debug,
+		pid:      pid,
+		z:        z,
+		collectC: z.collectC,
+		debug:    z.c.Debug,
 	}
 	client := client{
 		pid:   pid,
-		callC: callC,
 		debug: z.c.Debug,
 	}
 
@@ -156,16 +278,43 @@ func (z *Zmey) SetProcess(pid int, process Process) {
 		process: process,
 		api:     &api,
 		client:  &client,
-		callC:   callC,
-		returnC: returnC,
-		traceC:  traceC,
-		tickC:   tickC,
+	}
+	if exists {
+		// The new instance receives the events its predecessor missed, and
+		// carries on its vector clock, as on restart
+		p.membership = old.membership
+		p.clock = old.clock
 	}
 
 	z.packs[pid] = &p
 
 }
 
+// SetGroup names a group of processes, so that they can be addressed together
+// with API.Multicast, e.g. "replicas" or "clients". If `pids` is empty, the
+// group is removed. The processes must be set with SetProcess first,
+// otherwise SetGroup logs an error and leaves the group unchanged. The method
+// is thread-safe.
+func (z *Zmey) SetGroup(name string, pids []int) {
+	z.Lock()
+	defer z.Unlock()
+
+	if len(pids) == 0 {
+		delete(z.groups, name)
+		return
+	}
+	for _, pid := range pids {
+		if _, ok := z.packs[pid]; !ok {
+			log.Printf("[%4d] SetGroup: Error: no such process in group %q", pid, name)
+			return
+		}
+	}
+
+	group := append([]int{}, pids...)
+	sort.Ints(group)
+	z.groups[name] = group
+}
+
 // Inject sets inject function. The actual call of the injector occurs
 // in Round() method. Inject is thread-safe.
 func (z *Zmey) Inject(injectF InjectFunc) {
@@ -184,8 +333,57 @@ func (z *Zmey) Filter(filterF FilterFunc) {
 	z.filterF = filterF
 }
 
+// Latency sets the model delaying the messages in virtual time. If `latency`
+// is `nil`, messages are delivered without delay. The model requires
+// Config.Deterministic, otherwise Latency logs an error and sets nothing. Its
+// delays are drawn from a pseudo-random generator derived from the seed.
+// Latency is thread-safe.
+func (z *Zmey) Latency(latency LatencyModel) {
+	z.Lock()
+	defer z.Unlock()
+
+	if latency != nil && !z.c.Deterministic {
+		log.Printf("[   Z] Latency: Error: not in deterministic mode")
+		return
+	}
+	z.latency = latency
+}
+
+// Faults sets the function injecting faults in the messages: they may be
+// lost, duplicated or corrupted. If `faultF` is `nil`, the messages are
+// delivered as sent. Faults require Config.Deterministic, otherwise Faults
+// logs an error and sets nothing. They are recorded in ProcessResult.Faults of
+// the sender, and as EventFault. Faults is thread-safe.
+func (z *Zmey) Faults(faultF FaultFunc) {
+	z.Lock()
+	defer z.Unlock()
+
+	if faultF != nil && !z.c.Deterministic {
+		log.Printf("[   Z] Faults: Error: not in deterministic mode")
+		return
+	}
+	z.faultF = faultF
+}
+
+// Ordering sets the function telling which links deliver their messages in
+// order. If `orderingF` is `nil`, all the links are FIFO. On Unordered links,
+// the scheduler picks any of the buffered messages, so the ordering requires
+// Config.Deterministic, otherwise Ordering logs an error and sets nothing.
+// Ordering is thread-safe.
+func (z *Zmey) Ordering(orderingF OrderingFunc) {
+	z.Lock()
+	defer z.Unlock()
+
+	if orderingF != nil && !z.c.Deterministic {
+		log.Printf("[   Z] Ordering: Error: not in deterministic mode")
+		return
+	}
+	z.orderingF = orderingF
+}
+
 // Tick simulates time by calling `Tick()` method of all processes.
-// Each process receives the same time unit `t`. Tick is thread-safe.
+// Each process receives the same time unit `t`, scaled by the drift of its
+// clock (see Skew). Tick is thread-safe.
 func (z *Zmey) Tick(t uint) {
 	z.Lock()
 	defer z.Unlock()
@@ -193,95 +391,185 @@ func (z *Zmey) Tick(t uint) {
 	z.tick = t
 }
 
-// Round runs the simulation (inject and/or tick functions). It returns
-// the slice of slices of responses. An item `i` of the outer slice represents
-// the responces of the process with the id `i`. The responses of a particular
-// process are not in order, so some sorting is required for determenistic
-// behaviour. The ErrCancelled is returned if the context is cancelled
-// before the processing ends. The method is thread-safe, however no
-// parallel execution is implemented so far.
+// Advance lets the next deterministic Round move the virtual time forward by
+// up to `d` units. Whenever no message, call or tick is pending, the clock
+// jumps to the next timer; the Round ends with the clock `d` units ahead.
+// Without Advance, only the timers due at the current time fire. Advance is
+// thread-safe.
+func (z *Zmey) Advance(d uint) {
+	z.Lock()
+	defer z.Unlock()
+
+	z.advance = d
+}
+
+// Now returns the virtual time. Now is thread-safe.
+func (z *Zmey) Now() uint {
+	z.Lock()
+	defer z.Unlock()
+
+	return z.now
+}
+
+// Round runs the simulation (inject and/or tick functions). It returns the
+// responses and the traces of the Round, mapped by the id of the process.
+// Unless Config.Deterministic is set, the events are processed concurrently
+// by a pool of GOMAXPROCS workers, and the responses of a process are in
+// no particular order, so some sorting is required for deterministic
+// behaviour. ErrCancelled is returned as soon as the context is cancelled,
+// without waiting for the handlers still running. The method is thread-safe,
+// the Rounds of an instance run one after another.
+// If processes reported errors or panicked, the responses and traces are
+// returned along with a FailedError. See Run for the detailed result of the
+// Round, and RoundT to fail a test on errors.
 func (z *Zmey) Round(ctx context.Context) (map[int][]interface{}, map[int][]interface{}, error) {
 	z.Lock()
 	defer z.Unlock()
 
-	var wg sync.WaitGroup
-	cancelFs := []context.CancelFunc{}
+	if err := z.round(ctx); err != nil {
+		return nil, nil, err
+	}
 
-	session := NewSession()
+	result := z.collected()
+
+	return result.Responses(), result.Traces(), result.failed()
+}
 
-	ctxNet, cancelF := context.WithCancel(ctx)
-	net := NewNet(ctxNet, &wg, z.pids, session)
-	cancelFs = append(cancelFs, cancelF)
+func (z *Zmey) round(ctx context.Context) error {
+	z.resultLock.Lock()
+	z.started = time.Now()
+	z.resultLock.Unlock()
 
-	for i := range z.packs {
-		z.packs[i].api.BindNet(net)
+	if z.c.Deterministic {
+		choose, drops := z.chooser()
+		return z.roundDeterministic(ctx, choose, drops)
 	}
 
+	var wg, workersWg sync.WaitGroup
+
+	session := NewSession()
+
+	z.resultLock.Lock()
+	z.abortC = make(chan struct{})
+	z.resultLock.Unlock()
+	defer func() {
+		z.resultLock.Lock()
+		z.abortC = nil
+		z.resultLock.Unlock()
+	}()
+	abortC := z.abortC
+
+	d := newDriver(z, session)
+	net := newDrivenNet(z.pids, session, d.wakePid)
+	d.net = net
+	net.eventF = z.emit
+	if z.c.VectorClocks {
+		net.stampF = z.stamp
+	}
+	net.lastMsg = z.lastMsg
+	defer func() {
+		z.lastMsg = net.lastMsg
+	}()
+
 	if z.filterF != nil {
 		net.Filter(z.filterF)
 	}
 
 	for _, pack := range z.packs {
-		ctxProcess, cancelF := context.WithCancel(ctx)
-		cancelFs = append(cancelFs, cancelF)
-		go z.processLoop(ctxProcess, &wg, pack, session, net)
+		pack.api.BindNet(net)
+		pack.api.BindSession(session)
+		pack.client.drv = d
+		pack.calls = nil
+		pack.ticks = nil
+		pack.scheduled = false
+	}
+
+	// The membership events are queued before any worker runs
+	for _, pid := range z.pids {
+		pack := z.packs[pid]
+		for range pack.membership {
+			session.begin(flightMembership)
+		}
+		if len(pack.membership) > 0 {
+			d.wake(pack)
+		}
+	}
+	z.announced = false
+
+	// The workers may need to collect until they are done, so the collect
+	// loop is stopped after them
+	ctxCollect, cancelCollectF := context.WithCancel(context.Background())
+	defer cancelCollectF()
+	wg.Add(2)
+	go z.collectLoop(ctxCollect, &wg, session)
+	go z.statusLoop(ctxCollect, &wg, net, session)
+
+	ctxWorkers, cancelWorkersF := context.WithCancel(ctx)
+	defer cancelWorkersF()
+	for id := 0; id < runtime.GOMAXPROCS(0); id++ {
+		workersWg.Add(1)
+		go d.worker(ctxWorkers, &workersWg, id)
+	}
+
+	for _, pid := range z.pids {
+		if !z.packs[pid].isStarted {
+			session.begin(flightStart)
+			d.wake(z.packs[pid])
+		}
 	}
 
 	if z.injectF != nil {
-		for i := range z.packs {
-			go z.injectF(z.packs[i].pid, z.packs[i].client)
+		injectF := z.injectF
+		for _, pid := range z.pids {
+			session.begin(flightInject)
+			go func(pid int, c Client) {
+				defer session.end(flightInject)
+				injectF(pid, c)
+			}(pid, z.packs[pid].client)
 		}
 		z.injectF = nil
 	}
 
 	if z.tick != 0 {
-		for _, pack := range z.packs {
-			go z.tickF(pack, &wg, z.tick)
+		for _, pid := range z.pids {
+			d.tick(z.packs[pid], z.clocks[pid].duration(z.tick))
 		}
 		z.tick = 0
 	}
 
-	ctxCollect, cancelF := context.WithCancel(ctx)
-	cancelFs = append(cancelFs, cancelF)
-	go z.collectLoop(ctxCollect, &wg, session)
-
-	ctxStatus, cancelF := context.WithCancel(ctx)
-	cancelFs = append(cancelFs, cancelF)
-	go z.statusLoop(ctxStatus, &wg, net, session)
-
-	done := make(chan struct{})
+	var err error
+	aborted := false
+	select {
+	case <-session.idle():
+		// Nothing is left in flight, the goroutines can exit
+	case <-abortC:
+		aborted = true
+	case <-ctx.Done():
+		err = ErrCancelled
+	}
 
+	// The idle workers exit right away, but a worker stuck in a handler would
+	// never return: it's left behind once the context is cancelled
+	cancelWorkersF()
+	workersDoneC := make(chan struct{})
 	go func() {
-		session.WaitBusy()        // We need to make sure the processes started
-		session.WaitIdle()        // Then we wait them to finish processing
-		for i := range cancelFs { // Then call goroutines to exit
-			cancelFs[i]()
-		}
-		wg.Wait() // And wait for them
-		done <- struct{}{}
+		workersWg.Wait()
+		close(workersDoneC)
 	}()
-
 	select {
-	case <-done:
+	case <-workersDoneC:
 	case <-ctx.Done():
-		return nil, nil, ErrCancelled
-	}
-
-	responses := make(map[int][]interface{})
-	traces := make(map[int][]interface{})
-
-	for pid, pack := range z.packs {
-		traces[pid] = pack.traces
-		pack.traces = nil
+		err = ErrCancelled
 	}
+	cancelCollectF()
+	wg.Wait()
 
-	for pid, pack := range z.packs {
-		responses[pid] = pack.responses
-		pack.responses = nil
+	// The failure may have been the last event, which ends nothing
+	if aborted && session.unprocessed() {
+		z.abort()
 	}
 
-	return responses, traces, nil
-
+	return err
 }
 
 // Status returns a channel of strings which provides insights on the internal
@@ -291,7 +579,7 @@ func (z *Zmey) Status() <-chan string {
 }
 
 // BufferStats returns a channel of strings, each string is a table of buffered
-// messages in the network.
+// messages in the network. Nothing is reported for more than 100 processes.
 func (z *Zmey) BufferStats() <-chan string {
 	return z.bufferStatsC
 }
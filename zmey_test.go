@@ -1,7 +1,10 @@
 package zmey
 
 import (
+	"context"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -19,6 +22,57 @@ func (DummyProcess) ReceiveNet(int, interface{}) {}
 func (DummyProcess) ReceiveCall(interface{})     {}
 func (DummyProcess) Tick(uint)                   {}
 
+// apiProcess is a process bound to the API, which passes the calls and the
+// messages it receives to its handlers, if set. The test processes set the
+// handlers, or embed it.
+type apiProcess struct {
+	DummyProcess
+	api   API
+	callF func(api API, payload interface{})
+	netF  func(api API, from int, payload interface{})
+}
+
+func (p *apiProcess) BindAPI(a API) {
+	p.api = a
+}
+
+func (p *apiProcess) ReceiveCall(payload interface{}) {
+	if p.callF != nil {
+		p.callF(p.api, payload)
+	}
+}
+
+func (p *apiProcess) ReceiveNet(from int, payload interface{}) {
+	if p.netF != nil {
+		p.netF(p.api, from, payload)
+	}
+}
+
+// newTestZmey creates a Zmey running the processes 0 to n-1, made by
+// `factoryF`, and makes process 0 call each of the `calls` in the next Round
+func newTestZmey(c *Config, n int, factoryF FactoryFunc, calls ...interface{}) *Zmey {
+	z := NewZmey(c)
+	for pid := 0; pid < n; pid++ {
+		z.SetProcess(pid, factoryF(pid))
+	}
+	if len(calls) > 0 {
+		z.Inject(callFirst(calls...))
+	}
+
+	return z
+}
+
+// callFirst returns an injector making process 0 call each of the `calls`
+func callFirst(calls ...interface{}) InjectFunc {
+	return func(pid int, c Client) {
+		if pid == 0 {
+			for _, call := range calls {
+				c.Call(call)
+			}
+		}
+	}
+}
+
 func TestSetProcess(t *testing.T) {
 
 	z := NewZmey(&Config{})
@@ -65,3 +119,79 @@ func TestSetProcess(t *testing.T) {
 	assert.Equal(t, []int{}, z.pids)
 
 }
+
+func TestRoundCancelled(t *testing.T) {
+	releaseC := make(chan struct{})
+	defer close(releaseC)
+
+	// The handler never returns while the Round runs
+	z := newTestZmey(&Config{}, 1, func(int) Process {
+		return &apiProcess{callF: func(API, interface{}) { <-releaseC }}
+	}, "block")
+
+	ctx, cancelF := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancelF()
+
+	errC := make(chan error, 1)
+	go func() {
+		_, _, err := z.Round(ctx)
+		errC <- err
+	}()
+
+	select {
+	case err := <-errC:
+		assert.Equal(t, ErrCancelled, err)
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Round is blocked by the handler")
+	}
+}
+
+// BenchmarkRelay passes a call around the ring of processes, each operation
+// being a hop. The cost of a hop should not depend on the number of
+// processes.
+func BenchmarkRelay(b *testing.B) {
+	for _, deterministic := range []bool{false, true} {
+		for _, scale := range []int{100, 1000, 10000} {
+			b.Run(fmt.Sprintf("deterministic=%t/pids=%d", deterministic, scale), func(b *testing.B) {
+				z := NewZmey(&Config{Deterministic: deterministic})
+				for pid := 0; pid < scale; pid++ {
+					z.SetProcess(pid, newRelayProcess(pid, scale))
+				}
+				z.Inject(callFirst(relayMessage{Hops: b.N}))
+
+				b.ResetTimer()
+				if _, _, err := z.Round(context.Background()); err != nil {
+					b.Fatal(err)
+				}
+			})
+		}
+	}
+}
+
+func TestScale(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+
+	const scale = 10000
+
+	for _, deterministic := range []bool{false, true} {
+		z := NewZmey(&Config{Deterministic: deterministic})
+		for pid := 0; pid < scale; pid++ {
+			z.SetProcess(pid, newRelayProcess(pid, scale))
+		}
+		z.Inject(func(pid int, c Client) {
+			if pid%100 == 0 {
+				c.Call(relayMessage{ID: pid, Hops: 100})
+			}
+		})
+
+		responses, _ := z.RoundT(t, context.Background())
+
+		count := 0
+		for pid := range responses {
+			count += len(responses[pid])
+		}
+		assert.Equal(t, scale/100, count, "deterministic=%t", deterministic)
+	}
+}